@@ -0,0 +1,104 @@
+package dnsr
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type budgetKey struct{}
+
+// budget limits the work done for a single top-level resolution:
+// the total number of queries sent to name servers, and the number
+// of glueless name server sub-resolutions.
+// Safe for concurrent usage.
+type budget struct {
+	queries           int32
+	subresolutions    int32
+	exceeded          int32 // 1 if queries were exceeded, 2 if sub-resolutions
+	maxQueries        int32
+	maxSubresolutions int32
+}
+
+// withBudget returns a copy of ctx with a new budget.
+// A limit <= 0 is unlimited.
+func withBudget(ctx context.Context, maxQueries, maxSubresolutions int) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &budget{
+		maxQueries:        int32(maxQueries),
+		maxSubresolutions: int32(maxSubresolutions),
+	})
+}
+
+// budgetFrom returns the budget in ctx, or nil.
+func budgetFrom(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+// spendQuery charges a query to the budget in ctx, if any,
+// and counts it in r.stats if allowed.
+func (r *Resolver) spendQuery(ctx context.Context) error {
+	b := budgetFrom(ctx)
+	if b != nil {
+		if n := atomic.AddInt32(&b.queries, 1); b.maxQueries > 0 && n > b.maxQueries {
+			return r.exceed(b, exceededQueries)
+		}
+	}
+	atomic.AddUint64(&r.stats.Queries, 1)
+	return nil
+}
+
+// spendSubresolution charges a glueless sub-resolution to the budget in ctx, if any.
+func (r *Resolver) spendSubresolution(ctx context.Context) error {
+	b := budgetFrom(ctx)
+	if b == nil {
+		return nil
+	}
+	if n := atomic.AddInt32(&b.subresolutions, 1); b.maxSubresolutions > 0 && n > b.maxSubresolutions {
+		return r.exceed(b, exceededSubresolutions)
+	}
+	return nil
+}
+
+// Limits of a budget, in budget.exceeded.
+const (
+	exceededQueries        = 1
+	exceededSubresolutions = 2
+)
+
+// checkBudget returns ErrMaxQueries or ErrMaxSubResolutions
+// if the budget in ctx was exceeded.
+func checkBudget(ctx context.Context) error {
+	if b := budgetFrom(ctx); b != nil {
+		return b.err()
+	}
+	return nil
+}
+
+// err returns the error for the first limit of b that was exceeded, or nil.
+func (b *budget) err() error {
+	switch atomic.LoadInt32(&b.exceeded) {
+	case exceededQueries:
+		return ErrMaxQueries
+	case exceededSubresolutions:
+		return ErrMaxSubResolutions
+	}
+	return nil
+}
+
+// exceed marks limit of b as exceeded, counting the first limit exceeded
+// in r.stats. It returns the error for the first limit exceeded.
+func (r *Resolver) exceed(b *budget, limit int32) error {
+	if atomic.CompareAndSwapInt32(&b.exceeded, 0, limit) {
+		if limit == exceededQueries {
+			atomic.AddUint64(&r.stats.BudgetExceeded, 1)
+		} else {
+			atomic.AddUint64(&r.stats.SubResolutionsExceeded, 1)
+		}
+	}
+	return b.err()
+}
+
+// budgetExceeded returns true if err is ErrMaxQueries or ErrMaxSubResolutions.
+func budgetExceeded(err error) bool {
+	return err == ErrMaxQueries || err == ErrMaxSubResolutions
+}
@@ -0,0 +1,62 @@
+package dnsr
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestBudget(t *testing.T) {
+	r := NewResolver()
+	ctx := withBudget(context.Background(), 2, 1)
+	st.Expect(t, checkBudget(ctx), nil)
+	st.Expect(t, r.spendQuery(ctx), nil)
+	st.Expect(t, r.spendQuery(ctx), nil)
+	st.Expect(t, r.spendSubresolution(ctx), nil)
+	st.Expect(t, r.spendQuery(ctx), ErrMaxQueries)
+	st.Expect(t, r.spendSubresolution(ctx), ErrMaxQueries)
+	st.Expect(t, checkBudget(ctx), ErrMaxQueries)
+	st.Expect(t, r.Stats().Queries, uint64(2))
+	st.Expect(t, r.Stats().BudgetExceeded, uint64(1))
+
+	ctx = withBudget(context.Background(), 0, 0)
+	for i := 0; i < 1000; i++ {
+		st.Expect(t, r.spendQuery(ctx), nil)
+	}
+	st.Expect(t, r.spendQuery(context.Background()), nil)
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	n := newTestNet(t)
+	zone := ""
+	for i := 0; i < 20; i++ {
+		zone += fmt.Sprintf("nxns.com. IN NS ns%d.nowhere.example.com.\n", i)
+	}
+	n.server("192.5.6.30").add(t, zone)
+	r := newTestResolver(n, WithMaxQueries(10))
+	_, err := r.ResolveErr("www.nxns.com", "A")
+	st.Expect(t, err, ErrMaxQueries)
+	st.Expect(t, r.Stats().BudgetExceeded, uint64(1))
+	st.Expect(t, r.Stats().Queries <= 10, true)
+
+	r = newTestResolver(n, WithMaxQueries(0), WithMaxSubResolutions(2))
+	_, err = r.ResolveErr("www.nxns.com", "A")
+	st.Expect(t, err, ErrMaxSubResolutions)
+	st.Expect(t, r.Stats().BudgetExceeded, uint64(0))
+	st.Expect(t, r.Stats().SubResolutionsExceeded, uint64(1))
+}
+
+func TestBudgetSubResolutions(t *testing.T) {
+	r := NewResolver()
+	ctx := withBudget(context.Background(), 2, 1)
+	st.Expect(t, r.spendSubresolution(ctx), nil)
+	st.Expect(t, r.spendSubresolution(ctx), ErrMaxSubResolutions)
+	st.Expect(t, r.spendQuery(ctx), nil)
+	st.Expect(t, checkBudget(ctx), ErrMaxSubResolutions)
+	st.Expect(t, r.spendQuery(ctx), nil)
+	st.Expect(t, r.spendQuery(ctx), ErrMaxSubResolutions)
+	st.Expect(t, r.Stats().BudgetExceeded, uint64(0))
+	st.Expect(t, r.Stats().SubResolutionsExceeded, uint64(1))
+}
@@ -2,12 +2,12 @@ package dnsr
 
 import (
 	"sync"
-	"time"
 )
 
 type cache struct {
 	capacity int
 	expire   bool
+	clock    Clock
 	m        sync.RWMutex
 	entries  map[string]entry
 }
@@ -26,6 +26,7 @@ func newCache(capacity int, expire bool) *cache {
 		capacity: capacity,
 		entries:  make(map[string]entry),
 		expire:   expire,
+		clock:    systemClock{},
 	}
 }
 
@@ -85,7 +86,18 @@ func (c *cache) _evict() {
 	}
 }
 
+// cacheKey returns the cache key of qname in class qclass.
+// Records in class IN are cached by name.
+func cacheKey(qname, qclass string) string {
+	if qclass == "" || qclass == "IN" {
+		return qname
+	}
+	return qname + " " + qclass
+}
+
 // get returns a randomly ordered slice of DNS records.
+// It returns an empty slice for NXDOMAIN, and nil if qname
+// is not cached or all of its records have expired.
 func (c *cache) get(qname string) RRs {
 	c.m.RLock()
 	defer c.m.RUnlock()
@@ -93,13 +105,13 @@ func (c *cache) get(qname string) RRs {
 	if !ok {
 		return nil
 	}
-	if len(e) == 0 {
+	if e == nil {
 		return emptyRRs
 	}
 	if c.expire {
 		i := 0
 		rrs := make(RRs, len(e))
-		now := time.Now()
+		now := c.clock.Now()
 		for rr, _ := range e {
 			if !rr.Expiry.IsZero() && now.After(rr.Expiry) {
 				delete(e, rr)
@@ -108,6 +120,9 @@ func (c *cache) get(qname string) RRs {
 				i++
 			}
 		}
+		if i == 0 {
+			return nil // all expired
+		}
 		return rrs[:i]
 	} else {
 		i := 0
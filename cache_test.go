@@ -35,3 +35,14 @@ func TestExpiredCacheEntry(t *testing.T) {
 	rrs := c.get("expired.")
 	st.Expect(t, len(rrs), 0)
 }
+
+func TestAllExpiredCacheEntry(t *testing.T) {
+	c := newCache(100, true)
+	expired := time.Now().Add(-time.Minute)
+	c.add("expired.", RR{Name: "expired.", Type: "A", Value: "1.2.3.4", Expiry: expired})
+	st.Expect(t, c.get("expired.") == nil, true)
+	st.Expect(t, c.get("expired.") == nil, true) // a cache miss, not NXDOMAIN
+	c.addNX("nx.")
+	rrs := c.get("nx.")
+	st.Expect(t, rrs != nil && len(rrs) == 0, true)
+}
@@ -0,0 +1,213 @@
+package dnsr
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ResolveClassCtx is like ResolveCtx, finding DNS records of class qclass,
+// such as CH (CHAOS) or HS (Hesiod). Class IN, or an empty qclass,
+// is resolved by ResolveCtx.
+//
+// Delegations exist only in class IN, so records in other classes are
+// queried at the name servers of the closest enclosing zone of qname in
+// class IN: the name servers of a stub or forward zone, or else the
+// name servers found by resolving NS records in class IN. For example,
+// to query the version of a name server at 192.0.2.53:
+//
+//	r := dnsr.NewResolver(dnsr.WithStubZone("bind.", "192.0.2.53"))
+//	rrs, err := r.ResolveClassCtx(ctx, "version.bind", "TXT", "CH")
+//
+// Only records for qname in the answer section are cached and returned.
+// Local records and policy zones apply only to class IN.
+func (r *Resolver) ResolveClassCtx(ctx context.Context, qname, qtype, qclass string) (RRs, error) {
+	dclass, ok := stringToClass(qclass)
+	if !ok {
+		return nil, ErrUnknownClass
+	}
+	if dclass == dns.ClassINET {
+		return r.ResolveCtx(ctx, qname, qtype)
+	}
+	ctx, cancel := r.newResolution(ctx)
+	defer cancel()
+	return r.resolveClass(ctx, toLowerFQDN(qname), qtype, dclass)
+}
+
+// resolveClass resolves qname and qtype in class dclass, other than IN.
+func (r *Resolver) resolveClass(ctx context.Context, qname, qtype string, dclass uint16) (RRs, error) {
+	key := cacheKey(qname, classString(dclass))
+	rrs, err := r.cacheGet(ctx, key, qtype)
+	if err != nil || len(rrs) > 0 {
+		return rrs, err
+	}
+	qmsg := r.newQuery(qname, qtype)
+	qmsg.Question[0].Qclass = dclass
+	rmsg, err := r.queryClass(ctx, qname, qmsg)
+	if err != nil {
+		return nil, err
+	}
+	switch rmsg.Rcode {
+	case dns.RcodeSuccess:
+	case dns.RcodeNameError:
+		r.cache.addNX(key)
+		return nil, NXDOMAIN
+	default:
+		return nil, errors.New(dns.RcodeToString[rmsg.Rcode])
+	}
+	for _, drr := range rmsg.Answer {
+		if drr.Header().Class != dclass {
+			continue
+		}
+		rr, ok := r.convertRR(drr)
+		if !ok || rr.Name != qname {
+			continue
+		}
+		r.cache.add(key, rr)
+		if qtype == "" || rr.Type == qtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
+
+// queryClass sends qmsg to the name servers of the closest enclosing zone
+// of qname in class IN, in turn, and returns the first response.
+// Stub and forward zones enclosing qname are used before any other zones.
+func (r *Resolver) queryClass(ctx context.Context, qname string, qmsg *dns.Msg) (*dns.Msg, error) {
+	if z := r.zoneFor(qname); z != nil && z.forward {
+		return r.forwardClass(ctx, z, qmsg)
+	}
+	zone, nss, err := r.classNameservers(ctx, qname)
+	if err != nil {
+		return nil, err
+	}
+	qmsg.RecursionDesired = false
+	err = ErrNoResponse
+	for i := 0; i < len(nss) && i < MaxNameservers; i++ {
+		var rmsg *dns.Msg
+		rmsg, err = r.queryNameserver(ctx, zone, nss[i], qmsg)
+		if err == nil {
+			return rmsg, nil
+		}
+		if err == ErrTimeout || budgetExceeded(err) || err == ctx.Err() {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// classNameservers returns the closest enclosing zone of qname in class IN
+// and its name servers, from a stub zone if any.
+func (r *Resolver) classNameservers(ctx context.Context, qname string) (string, []nameserver, error) {
+	if z := r.zoneFor(qname); z != nil {
+		return z.zone, z.nameservers(), nil
+	}
+	for pname, ok := qname, true; ok; pname, ok = parent(pname) {
+		nrrs, err := r.resolve(ctx, pname, "NS", 0)
+		if err == ErrTimeout || budgetExceeded(err) || err == context.DeadlineExceeded {
+			return "", nil, err
+		}
+		if nss := r.withoutLame(pname, r.nameservers(ctx, pname, nrrs)); len(nss) > 0 {
+			return pname, nss, nil
+		}
+	}
+	return "", nil, ErrNoResponse
+}
+
+// queryNameserver sends qmsg to name server ns for zone, trying its
+// address hints, then resolving its addresses if it is glueless,
+// and returns the first response.
+func (r *Resolver) queryNameserver(ctx context.Context, zone string, ns nameserver, qmsg *dns.Msg) (*dns.Msg, error) {
+	addrs := ns.addrs
+	if len(addrs) == 0 {
+		if len(ns.hints) > 0 {
+			rmsg, err := r.queryAddrs(ctx, zone, ns.host, ns.hints, qmsg)
+			if err == nil || err == ErrTimeout || budgetExceeded(err) || err == ctx.Err() {
+				return rmsg, err
+			}
+		}
+		var err error
+		addrs, err = r.resolveGlueless(ctx, ns.host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.queryAddrs(ctx, zone, ns.host, addrs, qmsg)
+}
+
+// queryAddrs sends qmsg to the IP addresses of name server host in turn,
+// and returns the first response, or the last error if none responded.
+func (r *Resolver) queryAddrs(ctx context.Context, zone, host string, addrs []string, qmsg *dns.Msg) (*dns.Msg, error) {
+	err := ErrNoARecords
+	for i := 0; i < len(addrs) && i < MaxIPs; i++ {
+		var rmsg *dns.Msg
+		rmsg, err = r.query(ctx, zone, host, addrs[i], qmsg, 0)
+		if err == nil {
+			return rmsg, nil
+		}
+		if err == ErrTimeout || budgetExceeded(err) || err == ctx.Err() {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// forwardClass sends qmsg as a recursive query to the upstream name
+// servers for forward zone z, in order of health, until one responds,
+// failing over on timeouts like forward.
+func (r *Resolver) forwardClass(ctx context.Context, z *zoneConfig, qmsg *dns.Msg) (*dns.Msg, error) {
+	qmsg.RecursionDesired = true
+	err := ErrNoResponse
+	us := orderUpstreams(z.upstreams, r.clock.Now())
+	for i, u := range us {
+		if r.expiring(ctx) {
+			return nil, ErrTimeout
+		}
+		var rmsg *dns.Msg
+		start := r.clock.Now()
+		rmsg, err = u.query(r.withAttempt(ctx, len(us)-i), r, z.zone, qmsg, 0)
+		if budgetExceeded(err) || (err != nil && err == ctx.Err()) {
+			return nil, err
+		}
+		if err != nil {
+			u.failure(r.clock.Now())
+			continue
+		}
+		u.success(r.clock.Now().Sub(start))
+		return rmsg, nil
+	}
+	return nil, err
+}
+
+// stringToClass returns the DNS class named s, such as IN or CH,
+// including classes in the generic format of RFC 3597, such as CLASS3.
+// An empty s is class IN.
+func stringToClass(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	switch s {
+	case "":
+		return dns.ClassINET, true
+	case "CHAOS":
+		return dns.ClassCHAOS, true
+	}
+	if c, ok := dns.StringToClass[s]; ok {
+		return c, true
+	}
+	if strings.HasPrefix(s, "CLASS") {
+		c, err := strconv.ParseUint(s[len("CLASS"):], 10, 16)
+		return uint16(c), err == nil
+	}
+	return 0, false
+}
+
+// classString returns the name of the DNS class c, such as CH.
+func classString(c uint16) string {
+	if s, ok := dns.ClassToString[c]; ok {
+		return s
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
@@ -0,0 +1,125 @@
+package dnsr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// chaosCount returns the number of CHAOS queries received by s for qname.
+func (s *testServer) chaosCount(qname string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	n := 0
+	for _, q := range s.queries {
+		if q.Qclass == dns.ClassCHAOS && toLowerFQDN(q.Name) == qname {
+			n++
+		}
+	}
+	return n
+}
+
+func TestResolveClassStub(t *testing.T) {
+	n := newTestNet(t)
+	s := n.add(t, `
+bind.         CH SOA ns.bind. hostmaster.bind. 1 1800 900 604800 300
+bind.         CH NS  ns.bind.
+version.bind. CH TXT "9.18.0"
+`, "192.0.2.99")
+	r := newTestResolver(n, WithStubZone("bind.", "192.0.2.99"))
+	ctx := context.Background()
+
+	want := RRs{{Name: "version.bind.", Type: "TXT", Value: `"9.18.0"`, Class: "CH"}}
+	rrs, err := r.ResolveClassCtx(ctx, "version.bind", "TXT", "CH")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, want)
+	st.Expect(t, rrs[0].String(), "version.bind.\t      3600\tCH\tTXT\t\"9.18.0\"")
+
+	// Cached by class
+	rrs, err = r.ResolveClassCtx(ctx, "VERSION.BIND.", "TXT", "chaos")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, want)
+	st.Expect(t, s.chaosCount("version.bind."), 1)
+
+	// Records in other classes are not returned for class IN
+	rrs, err = r.ResolveCtx(ctx, "version.bind", "TXT")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 0)
+	st.Expect(t, s.chaosCount("version.bind."), 1)
+	rrs, err = r.ResolveClassCtx(ctx, "version.bind", "TXT", "CH")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, want)
+	st.Expect(t, s.chaosCount("version.bind."), 1)
+}
+
+func TestResolveClassIterative(t *testing.T) {
+	n := newTestNet(t)
+	chaos := func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		q := qmsg.Question[0]
+		if q.Qclass != dns.ClassCHAOS {
+			return rmsg
+		}
+		rmsg.Authoritative = true
+		rmsg.Ns, rmsg.Extra = nil, nil
+		if toLowerFQDN(q.Name) != "www.example.com." {
+			rmsg.Rcode = dns.RcodeNameError
+			return rmsg
+		}
+		rmsg.Answer = []dns.RR{&dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+			Txt: []string{"chaos"},
+		}}
+		return rmsg
+	}
+	s := n.server("192.0.2.53") // also 198.51.100.53
+	s.rewrite = chaos
+	r := newTestResolver(n)
+	ctx := context.Background()
+
+	rrs, err := r.ResolveClassCtx(ctx, "www.example.com", "TXT", "CH")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "TXT", Value: `"chaos"`, Class: "CH"}})
+
+	rrs, err = r.ResolveCtx(ctx, "www.example.com", "TXT")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "TXT", Value: `"hello world"`}})
+
+	_, err = r.ResolveClassCtx(ctx, "nx.example.com", "TXT", "CH")
+	st.Expect(t, err, NXDOMAIN)
+	_, err = r.ResolveClassCtx(ctx, "nx.example.com", "TXT", "CH")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, s.chaosCount("nx.example.com."), 1)
+
+	rrs, err = r.ResolveClassCtx(ctx, "www.example.com", "A", "IN")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "A", Value: "192.0.2.2"}})
+
+	_, err = r.ResolveClassCtx(ctx, "www.example.com", "TXT", "XX")
+	st.Expect(t, err, ErrUnknownClass)
+}
+
+func TestStringToClass(t *testing.T) {
+	tests := []struct {
+		s     string
+		class uint16
+		ok    bool
+	}{
+		{"", dns.ClassINET, true},
+		{"in", dns.ClassINET, true},
+		{"CH", dns.ClassCHAOS, true},
+		{"chaos", dns.ClassCHAOS, true},
+		{"HS", dns.ClassHESIOD, true},
+		{"CLASS3", dns.ClassCHAOS, true},
+		{"CLASSX", 0, false},
+		{"XX", 0, false},
+	}
+	for _, tt := range tests {
+		class, ok := stringToClass(tt.s)
+		st.Expect(t, class, tt.class)
+		st.Expect(t, ok, tt.ok)
+	}
+	st.Expect(t, classString(dns.ClassCHAOS), "CH")
+	st.Expect(t, classString(42), "CLASS42")
+}
@@ -0,0 +1,98 @@
+package dnsr
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Clock tells the time. A Resolver uses its Clock to expire cached
+// records and lame name servers, to back off from failed upstream name
+// servers, to schedule priming queries, to time resolutions, and to
+// decide whether a query can finish before the deadline of a resolution.
+// The default Clock is the system clock.
+//
+// Each resolution has a deadline by the Clock, set from the timeout of
+// the Resolver or the deadline of its context, whichever is earlier.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// WithClock specifies the Clock of a Resolver, for example
+// to test cache expiry and timeouts deterministically.
+func WithClock(c Clock) Option {
+	return func(r *Resolver) {
+		r.clock = c
+	}
+}
+
+// convertRR converts drr to an RR, expiring relative to the Clock of r
+// if r expires cached records.
+func (r *Resolver) convertRR(drr dns.RR) (RR, bool) {
+	var now time.Time
+	if r.expire {
+		now = r.clock.Now()
+	}
+	return convertRR(drr, now)
+}
+
+type deadlineKey struct{}
+
+// withDeadline returns a copy of ctx with the deadline of ctx by the Clock
+// of r, if ctx has a deadline.
+func (r *Resolver) withDeadline(ctx context.Context) context.Context {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, deadlineKey{}, r.clock.Now().Add(time.Until(dl)))
+}
+
+// deadline returns the deadline of the resolution in ctx by the Clock
+// of r, or the deadline of ctx if ctx is not a resolution.
+// An earlier attempt deadline in ctx takes precedence.
+func (r *Resolver) deadline(ctx context.Context) (time.Time, bool) {
+	dl, ok := ctx.Deadline()
+	if cdl, cok := ctx.Value(deadlineKey{}).(time.Time); cok {
+		dl, ok = cdl, true
+	}
+	if adl, aok := ctx.Value(attemptKey{}).(time.Time); aok && (!ok || adl.Before(dl)) {
+		dl, ok = adl, true
+	}
+	return dl, ok
+}
+
+type attemptKey struct{}
+
+// withAttempt returns a context for one of n remaining attempts, such as
+// queries to upstream name servers in turn, limited to an equal share of
+// the time left until the deadline of ctx by the Clock of r, but no less
+// than TypicalResponseTime. A silent name server cannot use up the time
+// left for the others.
+func (r *Resolver) withAttempt(ctx context.Context, n int) context.Context {
+	dl, ok := r.deadline(ctx)
+	if !ok || n <= 1 {
+		return ctx
+	}
+	now := r.clock.Now()
+	limit := dl.Sub(now) / time.Duration(n)
+	if limit < TypicalResponseTime {
+		limit = TypicalResponseTime
+	}
+	return context.WithValue(ctx, attemptKey{}, now.Add(limit))
+}
+
+// expiring returns true if a query in ctx cannot finish before the deadline
+// of ctx by the Clock of r.
+func (r *Resolver) expiring(ctx context.Context) bool {
+	dl, ok := r.deadline(ctx)
+	return ok && r.clock.Now().After(dl.Add(-TypicalResponseTime))
+}
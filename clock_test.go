@@ -0,0 +1,156 @@
+package dnsr
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// testClock is a Clock that only moves when advanced.
+type testClock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+func (c *testClock) advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestClockCache(t *testing.T) {
+	clock := newTestClock()
+	c := newCache(100, true)
+	c.clock = clock
+	rr := RR{Name: "alive.", Type: "A", Value: "1.2.3.4", TTL: time.Minute, Expiry: clock.Now().Add(time.Minute)}
+	c.add("alive.", rr)
+	st.Expect(t, c.get("alive."), RRs{rr})
+	clock.advance(time.Minute)
+	st.Expect(t, c.get("alive."), RRs{rr})
+	clock.advance(time.Nanosecond)
+	st.Expect(t, len(c.get("alive.")), 0)
+}
+
+func TestClockExpiry(t *testing.T) {
+	clock := newTestClock()
+	n := newTestNet(t)
+	s := n.server("192.0.2.53")
+	s.add(t, "ttl.example.com. 60 IN A 192.0.2.3\n")
+	r := newTestResolver(n, WithExpiry(), WithClock(clock))
+	rrs, err := r.ResolveErr("ttl.example.com", "A")
+	st.Assert(t, err, nil)
+	st.Assert(t, len(rrs), 1)
+	st.Expect(t, rrs[0].TTL, time.Minute)
+	st.Expect(t, rrs[0].Expiry, clock.Now().Add(time.Minute))
+
+	queries := s.count("ttl.example.com.")
+	clock.advance(time.Minute)
+	rrs, err = r.ResolveErr("ttl.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 1)
+	st.Expect(t, s.count("ttl.example.com."), queries)
+
+	clock.advance(time.Second)
+	rrs, err = r.ResolveErr("ttl.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Assert(t, len(rrs), 1)
+	st.Expect(t, s.count("ttl.example.com.") > queries, true)
+	st.Expect(t, rrs[0].Expiry, clock.Now().Add(time.Minute))
+}
+
+func TestClockDeadline(t *testing.T) {
+	clock := newTestClock()
+	n := newTestNet(t)
+	r := newTestResolver(n, WithClock(clock))
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(time.Minute))
+	defer cancel()
+	qmsg := r.newQuery("www.example.com.", "A")
+
+	clock.advance(time.Minute - TypicalResponseTime - time.Millisecond)
+	rmsg, err := r.query(ctx, "example.com.", "ns1.example.com.", "192.0.2.53", qmsg, 1)
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rmsg.Answer), 1)
+
+	clock.advance(2 * time.Millisecond)
+	_, err = r.query(ctx, "example.com.", "ns1.example.com.", "192.0.2.53", qmsg, 1)
+	st.Expect(t, err, ErrTimeout)
+}
+
+func TestClockLame(t *testing.T) {
+	clock := newTestClock()
+	r := newTestResolver(newTestNet(t), WithClock(clock))
+	r.markLame(context.Background(), "example.com.", "ns1.example.com.", "test", 1)
+	st.Expect(t, len(r.LameServers()), 1)
+	clock.advance(LameDuration + time.Second)
+	st.Expect(t, len(r.LameServers()), 0)
+}
+
+func TestClockResolveDeadline(t *testing.T) {
+	clock := newTestClock()
+	advance := HookFunc(func(ctx context.Context, e Event) {
+		if _, ok := e.(ResolveStartEvent); ok {
+			clock.advance(Timeout)
+		}
+	})
+	r := newTestResolver(newTestNet(t), WithClock(clock), WithHook(advance))
+	_, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, ErrTimeout)
+}
+
+func TestClockUpstreams(t *testing.T) {
+	clock := newTestClock()
+	n := newTestNet(t)
+	recursor := n.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+www.example.com.    IN A   192.0.2.2
+mail.example.com.   IN A   192.0.2.3
+ftp.example.com.    IN A   192.0.2.4
+`, "10.3.0.2")
+	recursor.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Authoritative = false
+		rmsg.RecursionAvailable = qmsg.RecursionDesired
+		return rmsg
+	}
+	r := newTestResolver(n, WithForwarders("10.3.0.1", "10.3.0.2"), WithClock(clock))
+	for _, name := range []string{"www", "mail", "ftp"} {
+		_, err := r.ResolveErr(name+".example.com", "A")
+		st.Expect(t, err, nil)
+	}
+	st.Expect(t, r.Upstreams()[0].Healthy, false)
+	clock.advance(upstreamBackoff - time.Nanosecond)
+	st.Expect(t, r.Upstreams()[0].Healthy, false)
+	clock.advance(time.Nanosecond)
+	st.Expect(t, r.Upstreams()[0].Healthy, true)
+}
+
+func TestClockPriming(t *testing.T) {
+	clock := newTestClock()
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	r := newTestResolver(n, WithPriming(time.Hour), WithClock(clock))
+	_, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	r.priming.m.Lock()
+	st.Expect(t, r.priming.next, clock.Now().Add(time.Hour))
+	r.priming.m.Unlock()
+
+	queries := root.count(".")
+	clock.advance(time.Hour - time.Second)
+	_, err = r.ResolveErr("example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, root.count("."), queries)
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"os"
 	"sync"
@@ -13,8 +15,13 @@ import (
 )
 
 var (
-	verbose  bool
-	resolver = dnsr.New(10000)
+	verbose    bool
+	qclass     string
+	dnstapPath string
+	dnstap     *dnsr.Dnstap
+	recordPath string
+	recorder   *dnsr.Recorder
+	resolver   = dnsr.New(10000)
 )
 
 func init() {
@@ -24,6 +31,24 @@ func init() {
 		false,
 		"print verbose info to the console",
 	)
+	flag.StringVar(
+		&qclass,
+		"class",
+		"IN",
+		"query class, such as CH for CHAOS queries",
+	)
+	flag.StringVar(
+		&dnstapPath,
+		"dnstap",
+		"",
+		"log queries and responses in dnstap format to a file or Unix socket",
+	)
+	flag.StringVar(
+		&recordPath,
+		"record",
+		"",
+		"record queries and responses to a file, for replay with dnsr.WithReplay",
+	)
 }
 
 func logV(fmt string, args ...interface{}) {
@@ -47,8 +72,27 @@ func main() {
 	} else if _, isType := dns.StringToType[args[len(args)-1]]; len(args) > 1 && isType {
 		qtype, args = args[len(args)-1], args[:len(args)-1]
 	}
-	if verbose {
-		dnsr.DebugLogger = os.Stderr
+	if dnstapPath != "" {
+		var err error
+		if fi, serr := os.Stat(dnstapPath); serr == nil && fi.Mode()&os.ModeSocket != 0 {
+			dnstap, err = dnsr.DialDnstap(dnstapPath)
+		} else {
+			dnstap, err = dnsr.CreateDnstap(dnstapPath)
+		}
+		if err != nil {
+			color.Fprintf(os.Stderr, "dnstap: %s\n", err)
+			os.Exit(1)
+		}
+		defer dnstap.Close()
+	}
+	if recordPath != "" {
+		f, err := os.Create(recordPath)
+		if err != nil {
+			color.Fprintf(os.Stderr, "record: %s\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		recorder = dnsr.NewRecorder(f)
 	}
 	var wg sync.WaitGroup
 	start := time.Now()
@@ -73,7 +117,20 @@ func query(name, qtype string) {
 		os.Exit(1)
 	}
 
-	rrs, err := resolver.ResolveErr(qname, qtype)
+	// Trace each query separately, so concurrent traces are not interleaved
+	ctx := context.Background()
+	var trace bytes.Buffer
+	if verbose {
+		ctx = dnsr.ContextWithHook(ctx, dnsr.NewTreePrinter(&trace))
+	}
+	if dnstap != nil {
+		ctx = dnsr.ContextWithHook(ctx, dnstap)
+	}
+	if recorder != nil {
+		ctx = dnsr.ContextWithHook(ctx, recorder)
+	}
+	rrs, err := resolver.ResolveClassCtx(ctx, qname, qtype, qclass)
+	os.Stderr.Write(trace.Bytes())
 
 	color.Printf("\n")
 	if len(rrs) > 0 {
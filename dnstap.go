@@ -0,0 +1,304 @@
+package dnsr
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Dnstap is a Hook that logs each query to a name server and its response
+// in the dnstap format (https://dnstap.info), as RESOLVER_QUERY and
+// RESOLVER_RESPONSE messages in a Frame Streams container, readable by
+// standard dnstap tools. Safe for concurrent usage.
+type Dnstap struct {
+	identity []byte
+	w        io.Writer
+	c        io.Closer
+	r        io.Reader // bidirectional, for Unix sockets
+
+	m   sync.Mutex
+	err error
+}
+
+var (
+	// ErrDnstapHandshake is returned when a dnstap reader
+	// rejects or does not complete the Frame Streams handshake.
+	ErrDnstapHandshake = errors.New("dnstap: bad Frame Streams handshake")
+
+	// ErrDnstapClosed is returned by Close if a Dnstap is already closed.
+	ErrDnstapClosed = errors.New("dnstap: closed")
+)
+
+// dnstapContentType is the Frame Streams content type of dnstap.
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// dnstapVersion is the version in dnstap messages.
+const dnstapVersion = "dnsr"
+
+// Frame Streams control frames and fields.
+const (
+	fstrmAccept      = 1
+	fstrmStart       = 2
+	fstrmStop        = 3
+	fstrmReady       = 4
+	fstrmFinish      = 5
+	fstrmContentType = 1
+	fstrmMaxControl  = 512
+)
+
+// dnstap protobuf enum values.
+const (
+	dnstapTypeMessage      = 1
+	dnstapResolverQuery    = 3
+	dnstapResolverResponse = 4
+	dnstapFamilyINET       = 1
+	dnstapFamilyINET6      = 2
+	dnstapProtocolUDP      = 1
+	dnstapProtocolDOT      = 3
+	dnstapProtocolDOH      = 4
+)
+
+// NewDnstap returns a Dnstap that writes a unidirectional Frame Streams
+// stream to w, for example a file. Close writes the end of the stream.
+func NewDnstap(w io.Writer) (*Dnstap, error) {
+	d := newDnstap(w, nil)
+	if err := d.control(fstrmStart, true); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// CreateDnstap returns a Dnstap that writes to the file at path,
+// replacing it if it exists.
+func CreateDnstap(path string) (*Dnstap, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	d, err := NewDnstap(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.c = f
+	return d, nil
+}
+
+// DialDnstap returns a Dnstap that writes to a dnstap reader listening
+// on the Unix socket at path, such as `dnstap -u path`, using a
+// bidirectional Frame Streams connection.
+func DialDnstap(path string) (*Dnstap, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	d := newDnstap(conn, conn)
+	d.c = conn
+	if err = d.control(fstrmReady, true); err == nil {
+		err = d.expect(fstrmAccept)
+	}
+	if err == nil {
+		err = d.control(fstrmStart, true)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func newDnstap(w io.Writer, r io.Reader) *Dnstap {
+	d := &Dnstap{w: w, r: r}
+	if host, err := os.Hostname(); err == nil {
+		d.identity = []byte(host)
+	}
+	return d
+}
+
+// Close ends the Frame Streams stream and closes the underlying file or
+// socket, if any. It returns the first error writing the stream.
+func (d *Dnstap) Close() error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.err == ErrDnstapClosed {
+		return d.err
+	}
+	err := d.writeLocked(controlFrame(fstrmStop, false))
+	if err == nil && d.r != nil {
+		err = d.expect(fstrmFinish)
+	}
+	if d.c != nil {
+		if cerr := d.c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	d.err = ErrDnstapClosed
+	return err
+}
+
+// Event implements Hook.
+func (d *Dnstap) Event(ctx context.Context, e Event) {
+	now := time.Now()
+	switch e := e.(type) {
+	case ExchangeSentEvent:
+		d.write(d.message(dnstapResolverQuery, e.Zone, e.Addr, e.Protocol, e.Query, nil, now, time.Time{}))
+	case ExchangeReceivedEvent:
+		if e.Response != nil {
+			d.write(d.message(dnstapResolverResponse, e.Zone, e.Addr, e.Protocol, e.Query, e.Response, now.Add(-e.Duration), now))
+		}
+	case ExchangeCancelledEvent:
+		if e.Response != nil {
+			d.write(d.message(dnstapResolverResponse, e.Zone, e.Addr, e.Protocol, e.Query, e.Response, now.Add(-e.Duration), now))
+		}
+	}
+}
+
+// message returns an encoded dnstap message of type typ for a query
+// to the name server at addr for zone.
+func (d *Dnstap) message(typ int, zone, addr string, proto Protocol, qmsg, rmsg *dns.Msg, qtime, rtime time.Time) []byte {
+	var m []byte
+	m = appendVarintField(m, 1, uint64(typ))
+	ip, port := dnstapAddr(addr, proto)
+	if ip != nil {
+		family := dnstapFamilyINET6
+		if ip4 := ip.To4(); ip4 != nil {
+			family, ip = dnstapFamilyINET, ip4
+		}
+		m = appendVarintField(m, 2, uint64(family))
+	}
+	switch proto {
+	case ProtocolTLS:
+		m = appendVarintField(m, 3, dnstapProtocolDOT)
+	case ProtocolHTTPS, ProtocolHTTPSGet:
+		m = appendVarintField(m, 3, dnstapProtocolDOH)
+	default:
+		m = appendVarintField(m, 3, dnstapProtocolUDP)
+	}
+	if ip != nil {
+		m = appendBytesField(m, 5, ip)
+		m = appendVarintField(m, 7, uint64(port))
+	}
+	m = appendVarintField(m, 8, uint64(qtime.Unix()))
+	m = appendFixed32Field(m, 9, uint32(qtime.Nanosecond()))
+	if qmsg != nil {
+		if wire, err := qmsg.Pack(); err == nil {
+			m = appendBytesField(m, 10, wire)
+		}
+	}
+	buf := make([]byte, 256)
+	if n, err := dns.PackDomainName(dns.Fqdn(zone), buf, 0, nil, false); err == nil {
+		m = appendBytesField(m, 11, buf[:n])
+	}
+	if rmsg != nil {
+		m = appendVarintField(m, 12, uint64(rtime.Unix()))
+		m = appendFixed32Field(m, 13, uint32(rtime.Nanosecond()))
+		if wire, err := rmsg.Pack(); err == nil {
+			m = appendBytesField(m, 14, wire)
+		}
+	}
+
+	var b []byte
+	if len(d.identity) > 0 {
+		b = appendBytesField(b, 1, d.identity)
+	}
+	b = appendBytesField(b, 2, []byte(dnstapVersion))
+	b = appendBytesField(b, 14, m)
+	b = appendVarintField(b, 15, dnstapTypeMessage)
+	return b
+}
+
+// dnstapAddr returns the IP address and port of a name server at addr,
+// or nil if addr is not an IP address, for example a DNS over HTTPS URL
+// with a host name.
+func dnstapAddr(addr string, proto Protocol) (net.IP, int) {
+	host, port := addr, ""
+	switch proto {
+	case ProtocolHTTPS, ProtocolHTTPSGet:
+		u, err := url.Parse(addr)
+		if err != nil {
+			return nil, 0
+		}
+		host, port = u.Hostname(), u.Port()
+		if port == "" {
+			port = "443"
+		}
+	case ProtocolTLS:
+		host, port, _ = net.SplitHostPort(withPort(addr, "853"))
+	default:
+		host, port, _ = net.SplitHostPort(withPort(addr, "53"))
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0
+	}
+	p, _ := strconv.Atoi(port)
+	return ip, p
+}
+
+// write writes a data frame with payload b.
+func (d *Dnstap) write(b []byte) {
+	frame := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(frame, uint32(len(b)))
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.writeLocked(append(frame, b...))
+}
+
+// writeLocked writes frame unless an earlier write failed.
+// The caller must hold d.m.
+func (d *Dnstap) writeLocked(frame []byte) error {
+	if d.err != nil {
+		return d.err
+	}
+	_, d.err = d.w.Write(frame)
+	return d.err
+}
+
+// control writes a control frame of type typ.
+func (d *Dnstap) control(typ uint32, contentType bool) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.writeLocked(controlFrame(typ, contentType))
+}
+
+// controlFrame returns a Frame Streams control frame of type typ,
+// with the dnstap content type if contentType is true.
+func controlFrame(typ uint32, contentType bool) []byte {
+	b := make([]byte, 12, 32)
+	binary.BigEndian.PutUint32(b[8:], typ)
+	if contentType {
+		b = appendUint32(b, fstrmContentType)
+		b = appendUint32(b, uint32(len(dnstapContentType)))
+		b = append(b, dnstapContentType...)
+	}
+	binary.BigEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b
+}
+
+// expect reads a control frame of type typ from a bidirectional stream.
+func (d *Dnstap) expect(typ uint32) error {
+	var hdr [12]byte
+	if _, err := io.ReadFull(d.r, hdr[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(hdr[4:])
+	if binary.BigEndian.Uint32(hdr[:]) != 0 || n < 4 || n > fstrmMaxControl || binary.BigEndian.Uint32(hdr[8:]) != typ {
+		return ErrDnstapHandshake
+	}
+	_, err := io.CopyN(ioutil.Discard, d.r, int64(n-4))
+	return err
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,208 @@
+package dnsr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// readFrame reads a Frame Streams frame, returning the control
+// type of a control frame, or 0 and the payload of a data frame.
+func readFrame(r io.Reader) (uint32, []byte, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return 0, nil, err
+	}
+	control := n == 0
+	if control {
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return 0, nil, err
+		}
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	if control {
+		return binary.BigEndian.Uint32(b), b[4:], nil
+	}
+	return 0, b, nil
+}
+
+// decodeProto decodes the fields of a protobuf message into
+// varints (including fixed32) and byte slices, by field number.
+func decodeProto(t *testing.T, b []byte) map[int]interface{} {
+	fields := make(map[int]interface{})
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		st.Assert(t, n > 0, true)
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			st.Assert(t, n > 0, true)
+			fields[field], b = v, b[n:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			st.Assert(t, n > 0, true)
+			fields[field], b = b[n:n+int(l)], b[n+int(l):]
+		case 5:
+			fields[field], b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+// readDnstap reads the dnstap messages in a unidirectional stream.
+func readDnstap(t *testing.T, r io.Reader) []map[int]interface{} {
+	typ, b, err := readFrame(r)
+	st.Assert(t, err, nil)
+	st.Expect(t, typ, uint32(fstrmStart))
+	st.Expect(t, string(b[8:]), dnstapContentType)
+	var msgs []map[int]interface{}
+	for {
+		typ, b, err := readFrame(r)
+		st.Assert(t, err, nil)
+		if typ == fstrmStop {
+			return msgs
+		}
+		st.Assert(t, typ, uint32(0))
+		d := decodeProto(t, b)
+		st.Expect(t, d[2], []byte(dnstapVersion))
+		st.Expect(t, d[15], uint64(dnstapTypeMessage))
+		msgs = append(msgs, decodeProto(t, d[14].([]byte)))
+	}
+}
+
+func TestDnstap(t *testing.T) {
+	var buf bytes.Buffer
+	d, err := NewDnstap(&buf)
+	st.Assert(t, err, nil)
+	n := newTestNet(t)
+	r := newTestResolver(n, WithForwardZone("example.com", "192.0.2.53"), WithHook(d))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 1)
+	st.Expect(t, d.Close(), nil)
+	st.Expect(t, d.Close(), ErrDnstapClosed)
+
+	msgs := readDnstap(t, &buf)
+	st.Assert(t, len(msgs), 2)
+	q, resp := msgs[0], msgs[1]
+	st.Expect(t, q[1], uint64(dnstapResolverQuery))
+	st.Expect(t, resp[1], uint64(dnstapResolverResponse))
+	for _, m := range msgs {
+		st.Expect(t, m[2], uint64(dnstapFamilyINET))
+		st.Expect(t, m[3], uint64(dnstapProtocolUDP))
+		st.Expect(t, net.IP(m[5].([]byte)).String(), "192.0.2.53")
+		st.Expect(t, m[7], uint64(53))
+		st.Expect(t, m[8] != nil, true)
+		st.Expect(t, m[11], []byte("\x07example\x03com\x00"))
+		qmsg := &dns.Msg{}
+		st.Assert(t, qmsg.Unpack(m[10].([]byte)), nil)
+		st.Expect(t, qmsg.Question[0].Name, "www.example.com.")
+	}
+	st.Expect(t, q[14], nil)
+	st.Expect(t, resp[12].(uint64) >= resp[8].(uint64), true)
+	rmsg := &dns.Msg{}
+	st.Assert(t, rmsg.Unpack(resp[14].([]byte)), nil)
+	st.Expect(t, rmsg.Response, true)
+	st.Expect(t, len(rmsg.Answer), 1)
+}
+
+func TestDialDnstap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	st.Assert(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+	l, err := net.Listen("unix", path)
+	st.Assert(t, err, nil)
+	defer l.Close()
+
+	types := make(chan uint32, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, _, err := readFrame(conn)
+			if err != nil {
+				return
+			}
+			types <- typ
+			switch typ {
+			case fstrmReady:
+				conn.Write(controlFrame(fstrmAccept, true))
+			case fstrmStop:
+				conn.Write(controlFrame(fstrmFinish, false))
+			}
+		}
+	}()
+
+	d, err := DialDnstap(path)
+	st.Assert(t, err, nil)
+	r := newTestResolver(newTestNet(t), WithForwardZone("example.com", "192.0.2.53"), WithHook(d))
+	_, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, d.Close(), nil)
+	var got []uint32
+	for i := 0; i < 5; i++ {
+		got = append(got, <-types)
+	}
+	st.Expect(t, got, []uint32{fstrmReady, fstrmStart, 0, 0, fstrmStop})
+}
+
+func TestDialDnstapRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnstap")
+	st.Assert(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+	l, err := net.Listen("unix", path)
+	st.Assert(t, err, nil)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		readFrame(conn)
+		conn.Write(controlFrame(fstrmFinish, false))
+	}()
+	_, err = DialDnstap(path)
+	st.Expect(t, err, ErrDnstapHandshake)
+}
+
+func TestDnstapAddr(t *testing.T) {
+	tests := []struct {
+		addr  string
+		proto Protocol
+		ip    string
+		port  int
+	}{
+		{"192.0.2.1:53", ProtocolUDP, "192.0.2.1", 53},
+		{"2001:db8::1", ProtocolUDP, "2001:db8::1", 53},
+		{"192.0.2.1", ProtocolTLS, "192.0.2.1", 853},
+		{"https://192.0.2.1/dns-query", ProtocolHTTPS, "192.0.2.1", 443},
+		{"https://[2001:db8::1]:8443/dns-query", ProtocolHTTPSGet, "2001:db8::1", 8443},
+		{"https://dns.example/dns-query", ProtocolHTTPS, "<nil>", 0},
+	}
+	for _, tt := range tests {
+		ip, port := dnstapAddr(tt.addr, tt.proto)
+		st.Expect(t, ip.String(), tt.ip)
+		st.Expect(t, port, tt.port)
+	}
+}
@@ -0,0 +1,45 @@
+package dnsr
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// exchanger sends a DNS query to a name server address
+// (host:port for UDP and TLS, a URL for HTTPS)
+// and returns the response.
+type exchanger interface {
+	exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error)
+}
+
+// udpExchanger is the default exchanger, which queries name servers over UDP.
+type udpExchanger struct{}
+
+func (udpExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	client := &dns.Client{Timeout: timeout}
+	return client.Exchange(qmsg, addr)
+}
+
+// checkResponse verifies that rmsg is a response to qmsg.
+// The ID, question type, class and name must match.
+// If exactCase is true, the question name must match with the same case,
+// as required by DNS 0x20 encoding.
+func checkResponse(qmsg, rmsg *dns.Msg, exactCase bool) error {
+	if rmsg.Id != qmsg.Id {
+		return ErrIDMismatch
+	}
+	if !rmsg.Response || len(rmsg.Question) != 1 || len(qmsg.Question) != 1 {
+		return ErrQuestionMismatch
+	}
+	q, rq := qmsg.Question[0], rmsg.Question[0]
+	if rq.Qtype != q.Qtype || rq.Qclass != q.Qclass || !strings.EqualFold(rq.Name, q.Name) {
+		return ErrQuestionMismatch
+	}
+	if exactCase && rq.Name != q.Name {
+		return ErrCaseMismatch
+	}
+	return nil
+}
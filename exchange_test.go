@@ -0,0 +1,74 @@
+package dnsr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestCheckResponse(t *testing.T) {
+	qmsg := &dns.Msg{}
+	qmsg.SetQuestion("wWw.ExAmple.cOm.", dns.TypeA)
+	rmsg := &dns.Msg{}
+	rmsg.SetReply(qmsg)
+	st.Expect(t, checkResponse(qmsg, rmsg, true), nil)
+
+	rmsg.Question[0].Name = "www.example.com."
+	st.Expect(t, checkResponse(qmsg, rmsg, false), nil)
+	st.Expect(t, checkResponse(qmsg, rmsg, true), ErrCaseMismatch)
+
+	rmsg.Question[0].Name = "www.example.net."
+	st.Expect(t, checkResponse(qmsg, rmsg, false), ErrQuestionMismatch)
+
+	rmsg.SetReply(qmsg)
+	rmsg.Question[0].Qtype = dns.TypeAAAA
+	st.Expect(t, checkResponse(qmsg, rmsg, false), ErrQuestionMismatch)
+
+	rmsg.SetReply(qmsg)
+	rmsg.Question = nil
+	st.Expect(t, checkResponse(qmsg, rmsg, false), ErrQuestionMismatch)
+
+	rmsg.SetReply(qmsg)
+	rmsg.Id++
+	st.Expect(t, checkResponse(qmsg, rmsg, false), ErrIDMismatch)
+}
+
+func TestCaseRandomization(t *testing.T) {
+	n := newTestNet(t)
+	r := newTestResolver(n, WithCaseRandomization())
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "192.0.2.2" }), 1)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Name != strings.ToLower(rr.Name) }), 0)
+}
+
+func TestCaseRandomizationMismatch(t *testing.T) {
+	n := newTestNet(t)
+	lower := func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Question[0].Name = strings.ToLower(rmsg.Question[0].Name)
+		return rmsg
+	}
+	n.server("192.0.2.53").rewrite = lower
+	r := newTestResolver(n, WithCaseRandomization())
+	rrs, _ := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 0)
+
+	r = newTestResolver(n)
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+}
+
+func TestSpoofedResponse(t *testing.T) {
+	n := newTestNet(t)
+	spoof := func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Id++
+		return rmsg
+	}
+	n.server("192.0.2.53").rewrite = spoof
+	r := newTestResolver(n)
+	rrs, _ := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 0)
+}
@@ -0,0 +1,225 @@
+package dnsr
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Hook receives events during resolution, for example to trace or measure
+// resolutions. Events are delivered synchronously from the goroutine that
+// caused them, so hooks must be fast and safe for concurrent usage.
+type Hook interface {
+	Event(ctx context.Context, e Event)
+}
+
+// HookFunc is a function that implements Hook.
+type HookFunc func(ctx context.Context, e Event)
+
+// Event implements Hook.
+func (f HookFunc) Event(ctx context.Context, e Event) {
+	f(ctx, e)
+}
+
+// Event is an event during resolution. Each event is one of the *Event
+// types in this package. Depth is the recursion depth of the resolution
+// that caused the event, starting at 1.
+type Event interface {
+	event()
+}
+
+// ResolveStartEvent is sent when a name is resolved that is not cached.
+// TopLevel is true for the name resolved by ResolveCtx, and false for
+// names resolved for it, such as CNAME targets and glueless name servers.
+type ResolveStartEvent struct {
+	QName, QType string
+	Depth        int
+	TopLevel     bool
+}
+
+// ResolveEndEvent is sent when a resolution started by ResolveStartEvent ends.
+type ResolveEndEvent struct {
+	QName, QType string
+	Depth        int
+	TopLevel     bool
+	RRs          RRs
+	Err          error
+	Duration     time.Duration
+}
+
+// CacheHitEvent is sent when a name is resolved from the cache.
+// Err is NXDOMAIN for a cached nonexistent name.
+type CacheHitEvent struct {
+	QName, QType string
+	Depth        int
+	RRs          RRs
+	Err          error
+}
+
+// CacheMissEvent is sent when a name is not found in the cache.
+type CacheMissEvent struct {
+	QName, QType string
+	Depth        int
+}
+
+// ExchangeSentEvent is sent when a query is sent to a name server for Zone.
+// Host is the name of the name server and Addr its address: host:port
+// for UDP and TLS, or a URL for HTTPS.
+type ExchangeSentEvent struct {
+	Zone       string
+	Host, Addr string
+	Protocol   Protocol
+	Query      *dns.Msg
+	Depth      int
+	Timeout    time.Duration
+}
+
+// ExchangeReceivedEvent is sent when a query to a name server returns
+// a response or fails.
+type ExchangeReceivedEvent struct {
+	Zone       string
+	Host, Addr string
+	Protocol   Protocol
+	Query      *dns.Msg
+	Response   *dns.Msg // nil on error
+	Depth      int
+	Duration   time.Duration
+	Timeout    time.Duration
+	Err        error
+}
+
+// ExchangeCancelledEvent is sent when a query to a name server finishes
+// after the resolution was cancelled or timed out.
+type ExchangeCancelledEvent struct {
+	Zone       string
+	Host, Addr string
+	Protocol   Protocol
+	Query      *dns.Msg
+	Response   *dns.Msg // may be nil
+	Depth      int
+	Duration   time.Duration
+	Timeout    time.Duration
+}
+
+// CNAMEFollowedEvent is sent when a CNAME record is followed.
+type CNAMEFollowedEvent struct {
+	CNAME RR
+	Depth int
+}
+
+// MaxRecursionEvent is sent when a resolution fails with ErrMaxRecursion.
+type MaxRecursionEvent struct {
+	QName, QType string
+	Depth        int
+}
+
+// ResponseRejectedEvent is sent when a response from a name server is
+// rejected because it does not match the query.
+type ResponseRejectedEvent struct {
+	Host     string
+	Query    *dns.Msg
+	Response *dns.Msg
+	Depth    int
+	Err      error
+}
+
+// RecordRejectedEvent is sent when a record in a response from a name
+// server for zone is rejected.
+type RecordRejectedEvent struct {
+	Host, Zone string
+	Record     dns.RR
+	Depth      int
+	Reason     string
+}
+
+// NameServer is a name server and its addresses, if known.
+type NameServer struct {
+	Host  string
+	Addrs []string
+}
+
+// ReferralEvent is sent when a name server refers to the name servers for Zone.
+type ReferralEvent struct {
+	Host, Zone  string
+	NameServers []NameServer
+	Depth       int
+}
+
+// LameEvent is sent when a name server is marked lame for zone.
+type LameEvent struct {
+	Host, Zone string
+	Reason     string
+	Depth      int
+}
+
+// PrimingEvent is sent after a priming query, with the names
+// of the root name servers if it succeeded.
+type PrimingEvent struct {
+	Roots []string
+	Err   error
+}
+
+// RootZoneEvent is sent when a query is answered from a local copy of the root zone.
+type RootZoneEvent struct {
+	Response *dns.Msg
+	Depth    int
+}
+
+// PolicyEvent is sent when a query matches a response policy zone rule.
+type PolicyEvent struct {
+	Hit PolicyHit
+}
+
+func (ResolveStartEvent) event()      {}
+func (ResolveEndEvent) event()        {}
+func (CacheHitEvent) event()          {}
+func (CacheMissEvent) event()         {}
+func (ExchangeSentEvent) event()      {}
+func (ExchangeReceivedEvent) event()  {}
+func (ExchangeCancelledEvent) event() {}
+func (CNAMEFollowedEvent) event()     {}
+func (MaxRecursionEvent) event()      {}
+func (ResponseRejectedEvent) event()  {}
+func (RecordRejectedEvent) event()    {}
+func (ReferralEvent) event()          {}
+func (LameEvent) event()              {}
+func (PrimingEvent) event()           {}
+func (RootZoneEvent) event()          {}
+func (PolicyEvent) event()            {}
+
+// WithHook specifies hooks that receive the events of all resolutions by a Resolver.
+func WithHook(hooks ...Hook) Option {
+	return func(r *Resolver) {
+		r.hooks = append(r.hooks, hooks...)
+	}
+}
+
+type hookKey struct{}
+
+// ContextWithHook returns a copy of ctx with hook h. Resolutions with the
+// returned context send their events to h, in addition to the hooks of the
+// Resolver and any hooks already in ctx.
+func ContextWithHook(ctx context.Context, h Hook) context.Context {
+	hooks := hooksFrom(ctx)
+	return context.WithValue(ctx, hookKey{}, append(hooks[:len(hooks):len(hooks)], h))
+}
+
+func hooksFrom(ctx context.Context) []Hook {
+	hooks, _ := ctx.Value(hookKey{}).([]Hook)
+	return hooks
+}
+
+// emit sends e to the hooks of r and ctx, and prints e to DebugLogger, if set.
+func (r *Resolver) emit(ctx context.Context, e Event) {
+	hooks := hooksFrom(ctx)
+	for _, h := range r.hooks {
+		h.Event(ctx, e)
+	}
+	for _, h := range hooks {
+		h.Event(ctx, e)
+	}
+	if DebugLogger != nil {
+		(&treePrinter{w: DebugLogger, mu: &mu}).Event(ctx, e)
+	}
+}
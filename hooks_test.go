@@ -0,0 +1,183 @@
+package dnsr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// eventRecorder is a Hook that records events.
+type eventRecorder struct {
+	m      sync.Mutex
+	events []Event
+}
+
+func (rec *eventRecorder) Event(ctx context.Context, e Event) {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	rec.events = append(rec.events, e)
+}
+
+// types returns the type names of the recorded events, without the package name.
+func (rec *eventRecorder) types() []string {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	var types []string
+	for _, e := range rec.events {
+		types = append(types, strings.TrimPrefix(fmt.Sprintf("%T", e), "dnsr."))
+	}
+	return types
+}
+
+// find returns the first recorded event matching f, or nil.
+func (rec *eventRecorder) find(f func(Event) bool) Event {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	for _, e := range rec.events {
+		if f(e) {
+			return e
+		}
+	}
+	return nil
+}
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent usage,
+// since queries in flight can write after a resolution returns.
+type lockedBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+func hasEvent(types []string, name string) bool {
+	for _, t := range types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHook(t *testing.T) {
+	rec := &eventRecorder{}
+	r := newTestResolver(newTestNet(t), WithHook(rec))
+	_, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	types := rec.types()
+	st.Expect(t, types[0], "CacheMissEvent")
+	st.Expect(t, types[1], "ResolveStartEvent")
+	for _, name := range []string{"ExchangeSentEvent", "ExchangeReceivedEvent", "ReferralEvent", "CacheHitEvent", "ResolveEndEvent"} {
+		st.Expect(t, hasEvent(types, name), true)
+	}
+	end, ok := rec.find(func(e Event) bool {
+		end, ok := e.(ResolveEndEvent)
+		return ok && end.Depth == 1
+	}).(ResolveEndEvent)
+	st.Assert(t, ok, true)
+	st.Expect(t, end.QName, "www.example.com.")
+	st.Expect(t, len(end.RRs), 1)
+
+	rec = &eventRecorder{}
+	ctx := ContextWithHook(context.Background(), rec)
+	_, err = r.ResolveCtx(ctx, "www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rec.types(), []string{"CacheHitEvent"})
+
+	r.ResolveCtx(ctx, "alias.example.com", "A")
+	st.Expect(t, hasEvent(rec.types(), "CNAMEFollowedEvent"), true)
+}
+
+func TestContextHook(t *testing.T) {
+	rrec, crec := &eventRecorder{}, &eventRecorder{}
+	r := newTestResolver(newTestNet(t), WithHook(rrec))
+	ctx := ContextWithHook(context.Background(), crec)
+	_, err := r.ResolveCtx(ctx, "www.example.com", "A")
+	st.Expect(t, err, nil)
+	isStart := func(qtype string) func(Event) bool {
+		return func(e Event) bool {
+			start, ok := e.(ResolveStartEvent)
+			return ok && start.QName == "www.example.com." && start.QType == qtype
+		}
+	}
+	st.Expect(t, crec.find(isStart("A")) != nil, true)
+	st.Expect(t, rrec.find(isStart("A")) != nil, true)
+
+	r.ResolveErr("www.example.com", "TXT")
+	st.Expect(t, crec.find(isStart("TXT")) == nil, true)
+	st.Expect(t, rrec.find(isStart("TXT")) != nil, true)
+
+	crec2 := &eventRecorder{}
+	r.ResolveCtx(ContextWithHook(ctx, crec2), "www.example.com", "MX")
+	st.Expect(t, crec.find(isStart("MX")) != nil, true)
+	st.Expect(t, crec2.find(isStart("MX")) != nil, true)
+}
+
+func TestMaxRecursionEvent(t *testing.T) {
+	l, err := ReadLocalZone(strings.NewReader("a.test. IN CNAME b.test.\nb.test. IN CNAME a.test.\n"))
+	st.Assert(t, err, nil)
+	rec := &eventRecorder{}
+	r := newTestResolver(newTestNet(t), WithLocalRecords(l), WithHook(rec))
+	r.ResolveErr("a.test", "A")
+	types := rec.types()
+	st.Expect(t, hasEvent(types, "MaxRecursionEvent"), true)
+	st.Expect(t, hasEvent(types, "CNAMEFollowedEvent"), true)
+}
+
+func TestTreePrinter(t *testing.T) {
+	buf := &lockedBuffer{}
+	r := newTestResolver(newTestNet(t), WithHook(NewTreePrinter(buf)))
+	r.ResolveErr("www.example.com", "A")
+	out := buf.String()
+	st.Expect(t, strings.HasPrefix(out, `╭─── resolve("www.example.com.", "A", 1)`), true)
+	st.Expect(t, regexp.MustCompile(`dig \+norecurse @ns[12]\.example\.com\. www\.example\.com\. A`).MatchString(out), true)
+	st.Expect(t, strings.Contains(out, "REFERRAL from @"), true)
+	st.Expect(t, strings.Contains(out, `ms: resolve("www.example.com.", "A", 1) # [1]RR = A(www.example.com.)=192.0.2.2`), true)
+}
+
+func TestDebugLoggerWithHooks(t *testing.T) {
+	// DebugLogger is global and read by queries still in flight, so it is
+	// set in a separate test process, which exits instead of restoring it.
+	if os.Getenv("DNSR_TEST_DEBUGLOGGER") == "1" {
+		DebugLogger = os.Stdout
+		rec := &eventRecorder{}
+		r := newTestResolver(newTestNet(t), WithHook(NewMetrics(), rec))
+		_, err := r.ResolveErr("www.example.com", "A")
+		st.Expect(t, err, nil)
+		st.Expect(t, hasEvent(rec.types(), "ResolveEndEvent"), true)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDebugLoggerWithHooks$")
+	cmd.Env = append(os.Environ(), "DNSR_TEST_DEBUGLOGGER=1")
+	out, err := cmd.Output()
+	st.Assert(t, err, nil)
+	st.Expect(t, strings.Contains(string(out), `╭─── resolve("www.example.com.", "A", 1)`), true)
+}
+
+func TestTreePrinterCancellation(t *testing.T) {
+	buf := &lockedBuffer{}
+	qmsg := &dns.Msg{}
+	qmsg.SetQuestion(".", dns.TypeNS)
+	// Priming and class queries have depth 0
+	NewTreePrinter(buf).Event(context.Background(), ExchangeCancelledEvent{Zone: ".", Host: "a.root-servers.net.", Query: qmsg})
+	st.Expect(t, buf.String(), "X    0ms (T- 0ms): dig +norecurse @a.root-servers.net. . NS == CANCELED ==\n")
+}
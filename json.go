@@ -0,0 +1,138 @@
+package dnsr
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// rrJSON is the JSON encoding of an RR, with member names from RFC 8427.
+// The record data is encoded in a member named "rdata" followed by the
+// type name, such as "rdataMX". Expiry is an extension of RFC 8427.
+type rrJSON struct {
+	Name      string     `json:"NAME"`
+	Type      uint16     `json:"TYPE"`
+	TypeName  string     `json:"TYPEname"`
+	Class     uint16     `json:"CLASS"`
+	ClassName string     `json:"CLASSname"`
+	TTL       uint64     `json:"TTL"`
+	Expiry    *time.Time `json:"expiry,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, encoding rr as an object with
+// RFC 8427 member names, for example:
+//
+//	{"NAME":"example.com.","TYPE":15,"TYPEname":"MX","CLASS":1,
+//	 "CLASSname":"IN","TTL":300,"expiry":"2020-01-01T00:05:00Z",
+//	 "rdataMX":"10 mail.example.com."}
+//
+// The TTL is in whole seconds. Expiry is omitted if zero.
+func (rr RR) MarshalJSON() ([]byte, error) {
+	v := rrJSON{
+		Name:      rr.Name,
+		Type:      typeCode(rr.Type),
+		TypeName:  rr.Type,
+		ClassName: rr.class(),
+		TTL:       uint64(rr.TTL / time.Second),
+	}
+	v.Class, _ = stringToClass(v.ClassName)
+	if !rr.Expiry.IsZero() {
+		v.Expiry = &rr.Expiry
+	}
+	b, err := json.Marshal(&v)
+	if err != nil {
+		return nil, err
+	}
+	// Insert the rdata member, named by type, before the closing brace.
+	key, err := json.Marshal("rdata" + rr.Type)
+	if err != nil {
+		return nil, err
+	}
+	value, err := json.Marshal(rr.Value)
+	if err != nil {
+		return nil, err
+	}
+	b = b[:len(b)-1]
+	b = append(b, ',')
+	b = append(b, key...)
+	b = append(b, ':')
+	b = append(b, value...)
+	return append(b, '}'), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding an RR encoded by
+// MarshalJSON. If TYPEname or CLASSname is absent, the type or class is
+// named from TYPE or CLASS. If both are absent, the class is IN.
+// Class names are case-insensitive, and normalized as by ResolveClassCtx.
+// It returns ErrEncoding if the name, type, or record data is missing,
+// or if the class is unknown.
+func (rr *RR) UnmarshalJSON(b []byte) error {
+	var v rrJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	if v.TypeName == "" && v.Type != 0 {
+		v.TypeName = typeName(v.Type)
+	}
+	class := v.ClassName
+	if class == "" && v.Class != 0 {
+		class = classString(v.Class)
+	}
+	if class != "" {
+		c, ok := stringToClass(class)
+		if !ok {
+			return ErrEncoding
+		}
+		class = classString(c)
+	}
+	if class == "IN" {
+		class = ""
+	}
+	if v.Name == "" || v.TypeName == "" {
+		return ErrEncoding
+	}
+	rdata, ok := members["rdata"+v.TypeName]
+	if !ok {
+		return ErrEncoding
+	}
+	var value string
+	if err := json.Unmarshal(rdata, &value); err != nil {
+		return err
+	}
+	*rr = RR{Name: v.Name, Type: v.TypeName, Value: value, TTL: time.Duration(v.TTL) * time.Second, Class: class}
+	if v.Expiry != nil {
+		rr.Expiry = *v.Expiry
+	}
+	return nil
+}
+
+// typeCode returns the numeric code of the record type named t,
+// including types in the generic format of RFC 3597, such as TYPE65,
+// or 0 if t is unknown.
+func typeCode(t string) uint16 {
+	if code, ok := dns.StringToType[t]; ok {
+		return code
+	}
+	if strings.HasPrefix(t, "TYPE") {
+		code, err := strconv.ParseUint(t[len("TYPE"):], 10, 16)
+		if err == nil {
+			return uint16(code)
+		}
+	}
+	return 0
+}
+
+// typeName returns the name of the record type with the numeric code t.
+func typeName(t uint16) string {
+	if name, ok := dns.TypeToString[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
@@ -0,0 +1,78 @@
+package dnsr
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// golden compares b with the golden file name in testdata,
+// or writes it if the -update flag is set.
+func golden(t *testing.T, name string, b []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		st.Assert(t, ioutil.WriteFile(path, b, 0644), nil)
+	}
+	want, err := ioutil.ReadFile(path)
+	st.Assert(t, err, nil)
+	if !bytes.Equal(b, want) {
+		t.Errorf("%s: got:\n%s\nwant:\n%s", path, b, want)
+	}
+}
+
+// goldenRRs are the records encoded in golden files.
+var goldenRRs = RRs{
+	{"example.com.", "A", "192.0.2.1", 300 * time.Second, time.Date(2020, 1, 1, 0, 5, 0, 0, time.UTC), ""},
+	{"example.com.", "MX", "10\tmail.example.com.", 3600 * time.Second, time.Date(2020, 1, 1, 1, 0, 0, 500, time.UTC), ""},
+	{"example.com.", "TXT", `"v=DKIM1; k=rsa; " "p=MIGf\"\\"`, 60 * time.Second, time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC), ""},
+	{"example.com.", "TYPE65", `\# 5 0001000001`, 0, time.Time{}, ""},
+	{"com.", "NS", "a.gtld-servers.net.", 0, time.Time{}, ""},
+	{"version.bind.", "TXT", `"9.18.0"`, 0, time.Time{}, "CH"},
+}
+
+func TestRRsJSON(t *testing.T) {
+	b, err := json.MarshalIndent(goldenRRs, "", "\t")
+	st.Assert(t, err, nil)
+	golden(t, "rrs.json", append(b, '\n'))
+
+	var rrs RRs
+	st.Assert(t, json.Unmarshal(b, &rrs), nil)
+	st.Expect(t, rrs, goldenRRs)
+}
+
+func TestRRJSON(t *testing.T) {
+	b, err := json.Marshal(goldenRRs[1])
+	st.Assert(t, err, nil)
+	st.Expect(t, string(b), `{"NAME":"example.com.","TYPE":15,"TYPEname":"MX","CLASS":1,"CLASSname":"IN","TTL":3600,"expiry":"2020-01-01T01:00:00.0000005Z","rdataMX":"10\tmail.example.com."}`)
+
+	var rr RR
+	st.Assert(t, json.Unmarshal([]byte(`{"NAME":"example.com.","TYPE":65,"TTL":60,"rdataTYPE65":"\\# 0"}`), &rr), nil)
+	st.Expect(t, rr, RR{Name: "example.com.", Type: "TYPE65", Value: `\# 0`, TTL: time.Minute})
+
+	st.Assert(t, json.Unmarshal([]byte(`{"NAME":"id.server.","TYPEname":"TXT","CLASS":3,"rdataTXT":"\"a\""}`), &rr), nil)
+	st.Expect(t, rr, RR{Name: "id.server.", Type: "TXT", Value: `"a"`, Class: "CH"})
+
+	st.Assert(t, json.Unmarshal([]byte(`{"NAME":"example.com.","TYPEname":"A","CLASSname":"in","rdataA":"192.0.2.1"}`), &rr), nil)
+	st.Expect(t, rr, RR{Name: "example.com.", Type: "A", Value: "192.0.2.1"})
+
+	st.Assert(t, json.Unmarshal([]byte(`{"NAME":"id.server.","TYPEname":"TXT","CLASSname":"chaos","rdataTXT":"\"a\""}`), &rr), nil)
+	st.Expect(t, rr, RR{Name: "id.server.", Type: "TXT", Value: `"a"`, Class: "CH"})
+
+	for _, s := range []string{
+		`{"TYPEname":"A","rdataA":"192.0.2.1"}`,
+		`{"NAME":"example.com.","rdataA":"192.0.2.1"}`,
+		`{"NAME":"example.com.","TYPEname":"A","rdataAAAA":"::1"}`,
+		`{"NAME":"example.com.","TYPEname":"A","CLASSname":"nope","rdataA":"192.0.2.1"}`,
+	} {
+		st.Expect(t, json.Unmarshal([]byte(s), &rr), ErrEncoding)
+	}
+	st.Reject(t, json.Unmarshal([]byte(`{"NAME":"example.com.","TYPEname":"A","rdataA":1}`), &rr), nil)
+}
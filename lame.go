@@ -0,0 +1,134 @@
+package dnsr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// LameServer describes a name server that is temporarily not queried
+// for a zone, because it returned a lame or broken response.
+type LameServer struct {
+	Zone   string
+	Host   string
+	Reason string
+	Expiry time.Time
+}
+
+type lameKey struct {
+	zone string
+	host string
+}
+
+// lameServers is a time-bounded set of lame name servers, by zone.
+// Safe for concurrent usage.
+type lameServers struct {
+	m       sync.Mutex
+	entries map[lameKey]LameServer
+}
+
+func newLameServers() *lameServers {
+	return &lameServers{entries: make(map[lameKey]LameServer)}
+}
+
+// add marks host as lame for zone until expiry.
+func (l *lameServers) add(zone, host, reason string, expiry time.Time) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.entries[lameKey{zone, host}] = LameServer{zone, host, reason, expiry}
+}
+
+// contains returns true if host is lame for zone at time now.
+func (l *lameServers) contains(zone, host string, now time.Time) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	k := lameKey{zone, host}
+	e, ok := l.entries[k]
+	if !ok {
+		return false
+	}
+	if now.After(e.Expiry) {
+		delete(l.entries, k)
+		return false
+	}
+	return true
+}
+
+// list returns the name servers lame at time now, sorted by zone and host.
+func (l *lameServers) list(now time.Time) []LameServer {
+	l.m.Lock()
+	defer l.m.Unlock()
+	var out []LameServer
+	for k, e := range l.entries {
+		if now.After(e.Expiry) {
+			delete(l.entries, k)
+			continue
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Zone != out[j].Zone {
+			return out[i].Zone < out[j].Zone
+		}
+		return out[i].Host < out[j].Host
+	})
+	return out
+}
+
+// LameServers returns the name servers currently marked lame by r.
+func (r *Resolver) LameServers() []LameServer {
+	return r.lame.list(r.clock.Now())
+}
+
+// markLame marks host as lame for zone for LameDuration.
+func (r *Resolver) markLame(ctx context.Context, zone, host, reason string, depth int) {
+	atomic.AddUint64(&r.stats.LameDelegations, 1)
+	r.emit(ctx, LameEvent{Host: host, Zone: zone, Reason: reason, Depth: depth})
+	if LameDuration <= 0 {
+		return
+	}
+	r.lame.add(zone, host, reason, r.clock.Now().Add(LameDuration))
+}
+
+// withoutLame returns the name servers in nss that are not lame for zone.
+// If all are lame, it returns nss, so resolution can still be attempted.
+func (r *Resolver) withoutLame(zone string, nss []nameserver) []nameserver {
+	now := r.clock.Now()
+	var out []nameserver
+	for _, ns := range nss {
+		if !r.lame.contains(zone, ns.host, now) {
+			out = append(out, ns)
+		}
+	}
+	if len(out) == 0 {
+		return nss
+	}
+	return out
+}
+
+// lameInvalidReferral is the lame reason for a referral that does not
+// lead closer to qname.
+const lameInvalidReferral = "invalid referral"
+
+// lameReason returns a non-empty reason if rmsg, a successful response
+// from a name server for zone, indicates a lame delegation: a
+// non-authoritative answer, or a referral that does not lead closer to qname.
+func lameReason(rmsg *dns.Msg, zone, qname string) string {
+	if rmsg.Rcode != dns.RcodeSuccess || rmsg.Authoritative {
+		return ""
+	}
+	if len(rmsg.Answer) > 0 {
+		return "non-authoritative answer"
+	}
+	if !isReferral(rmsg) {
+		return "non-authoritative response"
+	}
+	if parseReferral(rmsg, zone, qname) == nil {
+		return lameInvalidReferral
+	}
+	return ""
+}
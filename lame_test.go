@@ -0,0 +1,81 @@
+package dnsr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestLameServers(t *testing.T) {
+	l := newLameServers()
+	now := time.Now()
+	l.add("example.com.", "ns2.example.com.", "REFUSED", now.Add(time.Minute))
+	l.add("example.com.", "ns1.example.com.", "SERVFAIL", now.Add(time.Minute))
+	l.add("com.", "a.gtld-servers.net.", "REFUSED", now.Add(-time.Minute))
+	st.Expect(t, l.contains("example.com.", "ns1.example.com.", now), true)
+	st.Expect(t, l.contains("example.org.", "ns1.example.com.", now), false)
+	st.Expect(t, l.contains("com.", "a.gtld-servers.net.", now), false)
+	st.Expect(t, l.list(now), []LameServer{
+		{"example.com.", "ns1.example.com.", "SERVFAIL", now.Add(time.Minute)},
+		{"example.com.", "ns2.example.com.", "REFUSED", now.Add(time.Minute)},
+	})
+	st.Expect(t, len(l.list(now.Add(2*time.Minute))), 0)
+}
+
+func TestLameReason(t *testing.T) {
+	qmsg := &dns.Msg{}
+	qmsg.SetQuestion("www.example.com.", dns.TypeA)
+	rmsg := &dns.Msg{}
+	rmsg.SetReply(qmsg)
+	rr, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.2")
+	rmsg.Answer = []dns.RR{rr}
+	st.Expect(t, lameReason(rmsg, "example.com.", "www.example.com."), "non-authoritative answer")
+	rmsg.Authoritative = true
+	st.Expect(t, lameReason(rmsg, "example.com.", "www.example.com."), "")
+
+	rmsg.Authoritative = false
+	rr, _ = dns.NewRR("example.com. 300 IN NS ns1.example.com.")
+	rmsg.Answer, rmsg.Ns = nil, []dns.RR{rr}
+	st.Expect(t, lameReason(rmsg, "com.", "www.example.com."), "")
+	st.Expect(t, lameReason(rmsg, "example.com.", "www.example.com."), "invalid referral")
+
+	rmsg.Ns = nil
+	st.Expect(t, lameReason(rmsg, "example.com.", "www.example.com."), "non-authoritative response")
+}
+
+func TestLameDelegation(t *testing.T) {
+	n := newTestNet(t)
+	lame := n.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+`, "198.51.100.53")
+	lame.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Rcode = dns.RcodeRefused
+		rmsg.Answer, rmsg.Ns = nil, nil
+		return rmsg
+	}
+	r := newTestResolver(n)
+	resolve := func() {
+		rrs, err := r.ResolveErr("www.example.com", "TXT")
+		st.Expect(t, err, nil)
+		st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "TXT" }), 1)
+		r.cache.m.Lock()
+		delete(r.cache.entries, "www.example.com.")
+		r.cache.m.Unlock()
+	}
+	for i := 0; i < 10 && len(r.LameServers()) == 0; i++ {
+		resolve()
+	}
+	c := lame.count("www.example.com.")
+	for i := 0; i < 4; i++ {
+		resolve()
+	}
+	st.Expect(t, lame.count("www.example.com."), c)
+	lss := r.LameServers()
+	st.Assert(t, len(lss), 1)
+	st.Expect(t, lss[0].Zone, "example.com.")
+	st.Expect(t, lss[0].Host, "ns2.example.com.")
+	st.Expect(t, lss[0].Reason, "REFUSED")
+	st.Expect(t, r.Stats().LameDelegations > 0, true)
+}
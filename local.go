@@ -0,0 +1,175 @@
+package dnsr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// LocalRecords is a set of static records that override the DNS.
+// Names with local records are answered from the local records only,
+// without querying name servers. Safe for concurrent usage.
+type LocalRecords struct {
+	parse func(io.Reader) (map[string]RRs, map[string]bool, error)
+
+	m   sync.RWMutex
+	rrs map[string]RRs  // by lower-case owner name
+	nx  map[string]bool // names forced to NXDOMAIN
+}
+
+// ReadHosts reads local records from r in hosts file format:
+// an IP address followed by one or more names on each line, with
+// comments starting with #. IPv4 addresses add A records, and
+// IPv6 addresses add AAAA records.
+func ReadHosts(r io.Reader) (*LocalRecords, error) {
+	return readLocalRecords(r, parseHosts)
+}
+
+// ReadLocalZone reads local records from r in zone file format.
+// A CNAME record with the target "." forces NXDOMAIN for its owner name.
+// Other CNAME records are followed, and can point to names outside the
+// local records.
+func ReadLocalZone(r io.Reader) (*LocalRecords, error) {
+	return readLocalRecords(r, parseLocalZone)
+}
+
+func readLocalRecords(r io.Reader, parse func(io.Reader) (map[string]RRs, map[string]bool, error)) (*LocalRecords, error) {
+	l := &LocalRecords{parse: parse}
+	if err := l.Reload(r); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload replaces the contents of l with the records read from r,
+// in the same format l was originally read from.
+// If r cannot be parsed, l is unchanged and an error is returned.
+func (l *LocalRecords) Reload(r io.Reader) error {
+	rrs, nx, err := l.parse(r)
+	if err != nil {
+		return err
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.rrs, l.nx = rrs, nx
+	return nil
+}
+
+// parseHosts parses records in hosts file format.
+func parseHosts(r io.Reader) (map[string]RRs, map[string]bool, error) {
+	rrs := make(map[string]RRs)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || len(fields) < 2 {
+			return nil, nil, fmt.Errorf("hosts: invalid entry on line %d: %q", line, s.Text())
+		}
+		rr := RR{Type: "A", Value: ip.String()}
+		if ip.To4() == nil {
+			rr.Type = "AAAA"
+		}
+		for _, name := range fields[1:] {
+			rr.Name = toLowerFQDN(name)
+			rrs[rr.Name] = append(rrs[rr.Name], rr)
+		}
+	}
+	return rrs, nil, s.Err()
+}
+
+// parseLocalZone parses records in zone file format.
+func parseLocalZone(r io.Reader) (map[string]RRs, map[string]bool, error) {
+	rrs := make(map[string]RRs)
+	nx := make(map[string]bool)
+	for t := range dns.ParseZone(r, ".", "") {
+		if t.Error != nil {
+			return nil, nil, t.Error
+		}
+		if c, ok := t.RR.(*dns.CNAME); ok && c.Target == "." {
+			nx[toLowerFQDN(c.Hdr.Name)] = true
+			continue
+		}
+		rr, ok := convertRR(t.RR, time.Time{})
+		if !ok {
+			continue
+		}
+		rrs[rr.Name] = append(rrs[rr.Name], rr)
+	}
+	return rrs, nx, nil
+}
+
+// lookup returns the records in l for qname and qtype, and CNAME
+// records for qname. It returns false if l has no records for qname.
+func (l *LocalRecords) lookup(qname, qtype string) (RRs, bool, error) {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	if l.nx[qname] {
+		return nil, true, NXDOMAIN
+	}
+	all, ok := l.rrs[qname]
+	if !ok {
+		return nil, false, nil
+	}
+	var rrs RRs
+	for _, rr := range all {
+		if qtype == "" || rr.Type == qtype || rr.Type == "CNAME" {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, true, nil
+}
+
+// WithLocalRecords specifies local records that override the DNS.
+// If more than one set of local records has records for a name,
+// the first takes precedence.
+func WithLocalRecords(ls ...*LocalRecords) Option {
+	return func(r *Resolver) {
+		r.local = append(r.local, ls...)
+	}
+}
+
+// localGet returns the local records for qname and qtype, following
+// CNAME records. It returns false if there are no local records for qname.
+// A name with local records but none of qtype returns an empty result.
+func (r *Resolver) localGet(ctx context.Context, qname, qtype string, depth int) (RRs, bool, error) {
+	for _, l := range r.local {
+		lrrs, ok, err := l.lookup(qname, qtype)
+		if !ok {
+			continue
+		}
+		atomic.AddUint64(&r.stats.LocalAnswers, 1)
+		if err != nil {
+			return nil, true, err
+		}
+		var rrs RRs
+		for _, rr := range lrrs {
+			rrs = append(rrs, rr)
+			if rr.Type != "CNAME" || qtype == "CNAME" || qtype == "" {
+				continue
+			}
+			r.emit(ctx, CNAMEFollowedEvent{CNAME: rr, Depth: depth})
+			crrs, _ := r.resolve(ctx, rr.Value, qtype, depth)
+			rrs = append(rrs, crrs...)
+		}
+		if rrs == nil {
+			rrs = emptyRRs
+		}
+		return rrs, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,111 @@
+package dnsr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestReadHosts(t *testing.T) {
+	l, err := ReadHosts(strings.NewReader(`
+# comment
+127.0.0.1   localhost
+192.0.2.10  fixture.test  Alias.Test # trailing comment
+2001:db8::1 fixture.test
+`))
+	st.Assert(t, err, nil)
+	rrs, ok, err := l.lookup("fixture.test.", "A")
+	st.Expect(t, ok, true)
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "A", Value: "192.0.2.10"}})
+	rrs, _, _ = l.lookup("alias.test.", "A")
+	st.Expect(t, rrs, RRs{{Name: "alias.test.", Type: "A", Value: "192.0.2.10"}})
+	rrs, _, _ = l.lookup("fixture.test.", "AAAA")
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "AAAA", Value: "2001:db8::1"}})
+	_, ok, _ = l.lookup("other.test.", "A")
+	st.Expect(t, ok, false)
+
+	_, err = ReadHosts(strings.NewReader("not-an-ip example.com\n"))
+	st.Expect(t, err != nil, true)
+	_, err = ReadHosts(strings.NewReader("192.0.2.1\n"))
+	st.Expect(t, err != nil, true)
+}
+
+func TestReadLocalZone(t *testing.T) {
+	l, err := ReadLocalZone(strings.NewReader(`
+fixture.test.      IN A     192.0.2.10
+fixture.test.      IN TXT   "local"
+blocked.example.   IN CNAME .
+`))
+	st.Assert(t, err, nil)
+	rrs, ok, err := l.lookup("fixture.test.", "TXT")
+	st.Expect(t, ok, true)
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "TXT", Value: `"local"`}})
+	_, ok, err = l.lookup("blocked.example.", "A")
+	st.Expect(t, ok, true)
+	st.Expect(t, err, NXDOMAIN)
+
+	_, err = ReadLocalZone(strings.NewReader("fixture.test. IN A nope\n"))
+	st.Expect(t, err != nil, true)
+}
+
+func TestLocalRecords(t *testing.T) {
+	n := newTestNet(t)
+	l, err := ReadLocalZone(strings.NewReader(`
+fixture.test.      IN A     192.0.2.10
+fixture.test.      IN AAAA  2001:db8::10
+www.example.com.   IN A     192.0.2.99
+blocked.com.       IN CNAME .
+external.test.     IN CNAME alias.example.com.
+`))
+	st.Assert(t, err, nil)
+	r := newTestResolver(n, WithLocalRecords(l))
+
+	rrs, err := r.ResolveErr("fixture.test", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "A", Value: "192.0.2.10"}})
+	rrs, err = r.ResolveErr("fixture.test", "MX")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 0)
+	rrs, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "A", Value: "192.0.2.99"}})
+	_, err = r.ResolveErr("blocked.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, r.Stats().Queries, uint64(0))
+
+	// CNAME records are followed to the DNS, and back to local records
+	rrs, err = r.ResolveErr("external.test", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Name == "alias.example.com." && rr.Type == "CNAME" }) > 0, true)
+	rrs, err = r.ResolveErr("alias.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "192.0.2.99" }), 1)
+
+	// Reload
+	err = l.Reload(strings.NewReader("fixture.test. IN A 192.0.2.11\n"))
+	st.Expect(t, err, nil)
+	rrs, _ = r.ResolveErr("fixture.test", "A")
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "A", Value: "192.0.2.11"}})
+	rrs, _ = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Value == "192.0.2.2" }), 1)
+	err = l.Reload(strings.NewReader("fixture.test. IN A nope\n"))
+	st.Expect(t, err != nil, true)
+	rrs, _ = r.ResolveErr("fixture.test", "A")
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "A", Value: "192.0.2.11"}})
+	st.Expect(t, r.Stats().LocalAnswers > 0, true)
+}
+
+func TestLocalRecordsPrecedence(t *testing.T) {
+	a, err := ReadHosts(strings.NewReader("192.0.2.1 fixture.test\n"))
+	st.Assert(t, err, nil)
+	b, err := ReadHosts(strings.NewReader("192.0.2.2 fixture.test\n192.0.2.3 other.test\n"))
+	st.Assert(t, err, nil)
+	r := newTestResolver(newTestNet(t), WithLocalRecords(a, b))
+	rrs, _ := r.ResolveErr("fixture.test", "A")
+	st.Expect(t, rrs, RRs{{Name: "fixture.test.", Type: "A", Value: "192.0.2.1"}})
+	rrs, _ = r.ResolveErr("other.test", "A")
+	st.Expect(t, rrs, RRs{{Name: "other.test.", Type: "A", Value: "192.0.2.3"}})
+}
@@ -1,6 +1,7 @@
 package dnsr
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strings"
@@ -10,100 +11,151 @@ import (
 	"github.com/miekg/dns"
 )
 
-// DebugLogger will receive writes of DNS resolution traces if not nil.
+// DebugLogger will receive writes of DNS resolution traces if not nil,
+// in addition to any hooks.
+//
+// Deprecated: Output of concurrent resolutions is interleaved.
+// Use WithHook or ContextWithHook with NewTreePrinter instead.
 var DebugLogger io.Writer
 
 // serializes writes to the debug logger
 var mu sync.Mutex
 
-func logMaxRecursion(qname string, qtype string, depth int) {
-	if DebugLogger == nil {
-		return
-	}
-	mu.Lock()
-	defer mu.Unlock()
-	fmt.Fprintf(DebugLogger, "%s Error: MAX RECURSION @ %s %s %d\n",
-		strings.Repeat("│   ", depth-1), qname, qtype, depth)
+// treePrinter is a Hook that prints resolutions as a tree.
+type treePrinter struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+// NewTreePrinter returns a Hook that writes a human-readable trace of
+// each resolution to w, indented as a tree by recursion depth.
+func NewTreePrinter(w io.Writer) Hook {
+	return &treePrinter{w: w, mu: &sync.Mutex{}}
 }
 
-func logResolveStart(qname string, qtype string, depth int) {
-	if DebugLogger == nil {
-		return
+// Event implements Hook.
+func (p *treePrinter) Event(ctx context.Context, e Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch e := e.(type) {
+	case MaxRecursionEvent:
+		fmt.Fprintf(p.w, "%s Error: MAX RECURSION @ %s %s %d\n",
+			indent(e.Depth), e.QName, e.QType, e.Depth)
+	case ResolveStartEvent:
+		fmt.Fprintf(p.w, "%s╭─── resolve(\"%s\", \"%s\", %d)\n",
+			indent(e.Depth), e.QName, e.QType, e.Depth)
+	case ResolveEndEvent:
+		p.resolveEnd(e)
+	case CNAMEFollowedEvent:
+		fmt.Fprintf(p.w, "%s│    CNAME: %s\n", indent(e.Depth), e.CNAME.String())
+	case ExchangeReceivedEvent:
+		p.exchange(e)
+	case ExchangeCancelledEvent:
+		p.cancellation(e)
+	case ResponseRejectedEvent:
+		p.mismatch(e)
+	case RecordRejectedEvent:
+		fmt.Fprintf(p.w, "%s│    REJECTED %s from @%s (zone %s): %s\n",
+			indent(e.Depth), e.Reason, e.Host, e.Zone, strings.Replace(e.Record.String(), "\t", " ", -1))
+	case ReferralEvent:
+		fmt.Fprintf(p.w, "%s│    REFERRAL from @%s to %s:", indent(e.Depth), e.Host, e.Zone)
+		for _, ns := range e.NameServers {
+			if len(ns.Addrs) == 0 {
+				fmt.Fprintf(p.w, " %s (glueless)", ns.Host)
+			} else {
+				fmt.Fprintf(p.w, " %s %v", ns.Host, ns.Addrs)
+			}
+		}
+		fmt.Fprintf(p.w, "\n")
+	case LameEvent:
+		fmt.Fprintf(p.w, "%s│    LAME @%s for %s: %s\n", indent(e.Depth), e.Host, e.Zone, e.Reason)
+	case PrimingEvent:
+		if e.Err != nil {
+			fmt.Fprintf(p.w, "PRIMING failed, using previous root name servers # ERROR: %s\n", e.Err)
+			return
+		}
+		fmt.Fprintf(p.w, "PRIMING succeeded:")
+		for _, root := range e.Roots {
+			fmt.Fprintf(p.w, " %s", root)
+		}
+		fmt.Fprintf(p.w, "\n")
+	case RootZoneEvent:
+		rmsg := e.Response
+		fmt.Fprintf(p.w, "%s│    ROOT ZONE %s %s # rmsg: %s Answer: %d NS: %d Extra: %d\n",
+			indent(e.Depth), rmsg.Question[0].Name, dns.TypeToString[rmsg.Question[0].Qtype],
+			dns.RcodeToString[rmsg.Rcode], len(rmsg.Answer), len(rmsg.Ns), len(rmsg.Extra))
+	case PolicyEvent:
+		h := e.Hit
+		fmt.Fprintf(p.w, "POLICY %s %s %s: %s %s %s\n", h.Zone, h.QName, h.QType, h.Trigger, h.Rule, h.Action)
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	fmt.Fprintf(DebugLogger, "%s╭─── resolve(\"%s\", \"%s\", %d)\n",
-		strings.Repeat("│   ", depth-1), qname, qtype, depth)
 }
 
-func logResolveEnd(qname string, qtype string, rrs RRs, depth int, start time.Time, err error) {
-	if DebugLogger == nil {
-		return
+// indent returns the tree prefix for depth.
+func indent(depth int) string {
+	if depth < 1 {
+		return ""
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	dur := time.Since(start)
-	fmt.Fprintf(DebugLogger, "%s╰─── %dms: resolve(%q, %q, %d)",
-		strings.Repeat("│   ", depth-1), dur/time.Millisecond, qname, qtype, depth)
-	if rrs == nil {
-		fmt.Fprintf(DebugLogger, " # rrs = nil ")
-	} else if len(rrs) > 0 {
-		fmt.Fprintf(DebugLogger, " # [%d]RR = ", len(rrs))
+	return strings.Repeat("│   ", depth-1)
+}
+
+func (p *treePrinter) resolveEnd(e ResolveEndEvent) {
+	fmt.Fprintf(p.w, "%s╰─── %dms: resolve(%q, %q, %d)",
+		indent(e.Depth), e.Duration/time.Millisecond, e.QName, e.QType, e.Depth)
+	if e.RRs == nil {
+		fmt.Fprintf(p.w, " # rrs = nil ")
+	} else if len(e.RRs) > 0 {
+		fmt.Fprintf(p.w, " # [%d]RR = ", len(e.RRs))
 		end := 2
-		if end > len(rrs) {
-			end = len(rrs)
+		if end > len(e.RRs) {
+			end = len(e.RRs)
 		}
-		for _, rr := range rrs[:end] {
-			fmt.Fprintf(DebugLogger, "%s(%s)=%s ", rr.Type, rr.Name, rr.Value)
+		for _, rr := range e.RRs[:end] {
+			fmt.Fprintf(p.w, "%s(%s)=%s ", rr.Type, rr.Name, rr.Value)
 		}
-		if end < len(rrs) {
-			fmt.Fprintf(DebugLogger, "...")
+		if end < len(e.RRs) {
+			fmt.Fprintf(p.w, "...")
 		}
 	}
-	if err != nil {
-		fmt.Fprintf(DebugLogger, " # ERROR: %s", err)
+	if e.Err != nil {
+		fmt.Fprintf(p.w, " # ERROR: %s", e.Err)
 	}
-	fmt.Fprintf(DebugLogger, "\n")
+	fmt.Fprintf(p.w, "\n")
 }
 
-func logCNAME(cname string, depth int) {
-	if DebugLogger == nil {
-		return
+func (p *treePrinter) exchange(e ExchangeReceivedEvent) {
+	qmsg, rmsg := e.Query, e.Response
+	fmt.Fprintf(p.w, "%s│    %dms (T- %dms): dig +norecurse @%s %s %s ",
+		indent(e.Depth), e.Duration/time.Millisecond, e.Timeout/time.Millisecond, e.Host, qmsg.Question[0].Name, dns.TypeToString[qmsg.Question[0].Qtype])
+	if rmsg != nil {
+		fmt.Fprintf(p.w, " # rmsg: %s Answer: %d NS: %d Extra: %d",
+			dns.RcodeToString[rmsg.Rcode], len(rmsg.Answer), len(rmsg.Ns), len(rmsg.Extra))
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	fmt.Fprintf(DebugLogger, "%s│    CNAME: %s\n", strings.Repeat("│   ", depth-1), cname)
+	if e.Err != nil {
+		fmt.Fprintf(p.w, " # ERROR: %s", e.Err.Error())
+	}
+	fmt.Fprintf(p.w, "\n")
 }
 
-func logExchange(host string, qmsg *dns.Msg, rmsg *dns.Msg, depth int, dur time.Duration, timeout time.Duration, err error) {
-	if DebugLogger == nil {
-		return
-	}
-	mu.Lock()
-	defer mu.Unlock()
-	fmt.Fprintf(DebugLogger, "%s│    %dms (T- %dms): dig +norecurse @%s %s %s ",
-		strings.Repeat("│   ", depth-1), dur/time.Millisecond, timeout/time.Millisecond, host, qmsg.Question[0].Name, dns.TypeToString[qmsg.Question[0].Qtype])
+func (p *treePrinter) cancellation(e ExchangeCancelledEvent) {
+	qmsg, rmsg := e.Query, e.Response
+	fmt.Fprintf(p.w, "%sX    %dms (T- %dms): dig +norecurse @%s %s %s ",
+		indent(e.Depth), e.Duration/time.Millisecond, e.Timeout/time.Millisecond, e.Host, qmsg.Question[0].Name, dns.TypeToString[qmsg.Question[0].Qtype])
 	if rmsg != nil {
-		fmt.Fprintf(DebugLogger, " # rmsg: %s Answer: %d NS: %d Extra: %d",
+		fmt.Fprintf(p.w, " # rmsg: %s Answer: %d NS: %d Extra: %d ",
 			dns.RcodeToString[rmsg.Rcode], len(rmsg.Answer), len(rmsg.Ns), len(rmsg.Extra))
 	}
-	if err != nil {
-		fmt.Fprintf(DebugLogger, " # ERROR: %s", err.Error())
-	}
-	fmt.Fprintf(DebugLogger, "\n")
+	fmt.Fprintf(p.w, "== CANCELED ==\n")
 }
 
-func logCancellation(host string, qmsg *dns.Msg, rmsg *dns.Msg, depth int, dur time.Duration, timeout time.Duration) {
-	if DebugLogger == nil {
-		return
-	}
-	mu.Lock()
-	defer mu.Unlock()
-	fmt.Fprintf(DebugLogger, "%sX    %dms (T- %dms): dig +norecurse @%s %s %s ",
-		strings.Repeat("    ", depth-1), dur/time.Millisecond, timeout/time.Millisecond, host, qmsg.Question[0].Name, dns.TypeToString[qmsg.Question[0].Qtype])
+func (p *treePrinter) mismatch(e ResponseRejectedEvent) {
+	qmsg, rmsg := e.Query, e.Response
+	fmt.Fprintf(p.w, "%s│    REJECTED: dig +norecurse @%s %s %s # id: %d",
+		indent(e.Depth), e.Host, qmsg.Question[0].Name, dns.TypeToString[qmsg.Question[0].Qtype], qmsg.Id)
 	if rmsg != nil {
-		fmt.Fprintf(DebugLogger, " # rmsg: %s Answer: %d NS: %d Extra: %d ",
-			dns.RcodeToString[rmsg.Rcode], len(rmsg.Answer), len(rmsg.Ns), len(rmsg.Extra))
+		fmt.Fprintf(p.w, " # rmsg: id: %d", rmsg.Id)
+		for _, q := range rmsg.Question {
+			fmt.Fprintf(p.w, " %s %s", q.Name, dns.TypeToString[q.Qtype])
+		}
 	}
-	fmt.Fprintf(DebugLogger, "== CANCELED ==\n")
+	fmt.Fprintf(p.w, " # ERROR: %s\n", e.Err)
 }
@@ -0,0 +1,228 @@
+package dnsr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MetricsBuckets are the upper bounds in seconds of the buckets
+// of the latency histograms of a Metrics collector.
+var MetricsBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics is a Hook that collects metrics of resolutions, queries to name
+// servers and the cache, and exports them in the Prometheus text exposition
+// format. Safe for concurrent usage.
+type Metrics struct {
+	zones map[string]bool
+
+	m            sync.Mutex
+	resolutions  map[string]*metricsHistogram // by qtype, outcome
+	cache        map[string]uint64            // by result
+	exchanges    map[string]uint64            // by zone, qtype, rcode
+	exchangeTime map[string]*metricsHistogram // by zone
+}
+
+// metricsHistogram is a histogram with MetricsBuckets.
+type metricsHistogram struct {
+	labels  string
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewMetrics returns a Metrics collector. Queries to name servers are
+// labelled by zone: "." for the root, each of zones (for example forward
+// zones), and "other" for all other zones, to limit the number of series.
+func NewMetrics(zones ...string) *Metrics {
+	m := &Metrics{
+		zones:        make(map[string]bool),
+		resolutions:  make(map[string]*metricsHistogram),
+		cache:        make(map[string]uint64),
+		exchanges:    make(map[string]uint64),
+		exchangeTime: make(map[string]*metricsHistogram),
+	}
+	for _, zone := range zones {
+		m.zones[toLowerFQDN(zone)] = true
+	}
+	return m
+}
+
+// Event implements Hook.
+func (m *Metrics) Event(ctx context.Context, e Event) {
+	switch e := e.(type) {
+	case ResolveEndEvent:
+		if !e.TopLevel {
+			return
+		}
+		m.observe(m.resolutions, labels("qtype", e.QType, "outcome", outcome(e.RRs, e.Err)), e.Duration)
+	case CacheHitEvent:
+		m.add(m.cache, labels("result", "hit"))
+	case CacheMissEvent:
+		m.add(m.cache, labels("result", "miss"))
+	case ExchangeReceivedEvent:
+		rcode := "error"
+		switch {
+		case e.Response != nil:
+			rcode = dns.RcodeToString[e.Response.Rcode]
+		case isTimeout(e.Err):
+			rcode = "timeout"
+		}
+		m.exchange(e.Zone, e.Query, rcode, e.Duration)
+	case ExchangeCancelledEvent:
+		m.exchange(e.Zone, e.Query, "cancelled", e.Duration)
+	}
+}
+
+// exchange records a query to a name server for zone.
+func (m *Metrics) exchange(zone string, qmsg *dns.Msg, rcode string, dur time.Duration) {
+	if !m.zones[zone] && zone != "." {
+		zone = "other"
+	}
+	var qtype string
+	if qmsg != nil && len(qmsg.Question) > 0 {
+		qtype = dns.TypeToString[qmsg.Question[0].Qtype]
+	}
+	m.add(m.exchanges, labels("zone", zone, "qtype", qtype, "rcode", rcode))
+	m.observe(m.exchangeTime, labels("zone", zone), dur)
+}
+
+// outcome returns the outcome label of a resolution.
+func outcome(rrs RRs, err error) string {
+	switch {
+	case err == nil && len(rrs) > 0:
+		return "success"
+	case err == nil:
+		return "nodata"
+	case err == NXDOMAIN:
+		return "nxdomain"
+	case isTimeout(err):
+		return "timeout"
+	}
+	return "error"
+}
+
+// isTimeout returns true if err is a timeout.
+func isTimeout(err error) bool {
+	if err == ErrTimeout || err == context.DeadlineExceeded {
+		return true
+	}
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
+
+func (m *Metrics) add(counters map[string]uint64, labels string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	counters[labels]++
+}
+
+func (m *Metrics) observe(hists map[string]*metricsHistogram, labels string, dur time.Duration) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	h := hists[labels]
+	if h == nil {
+		h = &metricsHistogram{labels: labels, buckets: make([]uint64, len(MetricsBuckets))}
+		hists[labels] = h
+	}
+	v := dur.Seconds()
+	for i, le := range MetricsBuckets {
+		if v <= le {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// labels formats Prometheus labels from name and value pairs.
+func labels(kv ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(kv[i+1]))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// ServeHTTP implements http.Handler, writing the metrics
+// in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.Write(w)
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format.
+func (m *Metrics) Write(w io.Writer) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+	bw := bufio.NewWriter(w)
+	writeHistograms(bw, "dnsr_resolution_duration_seconds",
+		"Duration of resolutions not answered from the cache, by query type and outcome.", m.resolutions)
+	writeCounters(bw, "dnsr_cache_lookups_total",
+		"Cache lookups, by result.", m.cache)
+	writeCounters(bw, "dnsr_exchanges_total",
+		"Queries to name servers, by zone, query type and response code.", m.exchanges)
+	writeHistograms(bw, "dnsr_exchange_duration_seconds",
+		"Duration of queries to name servers, by zone.", m.exchangeTime)
+	return bw.Flush()
+}
+
+func writeCounters(w io.Writer, name, help string, counters map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, labels := range sortedKeys(counters) {
+		fmt.Fprintf(w, "%s{%s} %d\n", name, labels, counters[labels])
+	}
+}
+
+func writeHistograms(w io.Writer, name, help string, hists map[string]*metricsHistogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	keys := make([]string, 0, len(hists))
+	for k := range hists {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h := hists[k]
+		sep := ","
+		if h.labels == "" {
+			sep = ""
+		}
+		for i, le := range MetricsBuckets {
+			fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, h.labels, sep, strconv.FormatFloat(le, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, h.labels, sep, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, h.labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, h.labels, h.count)
+	}
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
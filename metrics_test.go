@@ -0,0 +1,98 @@
+package dnsr
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics("example.com")
+	r := newTestResolver(newTestNet(t), WithHook(m))
+	r.ResolveErr("www.example.com", "A")
+	r.ResolveErr("www.example.com", "A")
+	r.ResolveErr("nope.example.com", "A")
+	r.ResolveErr("www.example.com", "MX")
+
+	var buf bytes.Buffer
+	st.Expect(t, m.Write(&buf), nil)
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE dnsr_resolution_duration_seconds histogram",
+		`dnsr_resolution_duration_seconds_count{qtype="A",outcome="success"} 1`,
+		`dnsr_resolution_duration_seconds_count{qtype="A",outcome="nxdomain"} 1`,
+		`dnsr_resolution_duration_seconds_count{qtype="MX",outcome="nodata"} 1`,
+		`dnsr_resolution_duration_seconds_bucket{qtype="A",outcome="success",le="+Inf"} 1`,
+		"# TYPE dnsr_cache_lookups_total counter",
+		`dnsr_exchanges_total{zone=".",qtype="NS",rcode="NOERROR"} `,
+		`dnsr_exchanges_total{zone="example.com.",qtype="A",rcode="NOERROR"} `,
+		`dnsr_exchanges_total{zone="example.com.",qtype="A",rcode="NXDOMAIN"} `,
+		`dnsr_exchange_duration_seconds_bucket{zone="example.com.",le="0.001"} `,
+		`dnsr_exchange_duration_seconds_count{zone="other"} `,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %q in:\n%s", line, out)
+		}
+	}
+	st.Expect(t, strings.Contains(out, `dnsr_cache_lookups_total{result="hit"}`), true)
+	st.Expect(t, strings.Contains(out, `dnsr_cache_lookups_total{result="miss"}`), true)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+	st.Expect(t, strings.Contains(w.Body.String(), "dnsr_exchanges_total"), true)
+}
+
+func TestMetricsGlueless(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.5.6.30").add(t, `
+glueless.com.           IN NS  ns.glue.example.com.
+`)
+	n.server("192.0.2.53").add(t, `
+ns.glue.example.com.    IN A   203.0.113.53
+`)
+	n.add(t, `
+glueless.com.           IN SOA ns.glue.example.com. hostmaster.glueless.com. 1 1800 900 604800 300
+glueless.com.           IN NS  ns.glue.example.com.
+www.glueless.com.       IN A   203.0.113.80
+`, "203.0.113.53")
+	m := NewMetrics()
+	rec := &eventRecorder{}
+	r := newTestResolver(n, WithHook(m, rec))
+	_, err := r.ResolveErr("www.glueless.com", "A")
+	st.Expect(t, err, nil)
+
+	// The glueless name server is resolved at depth 1, but not top-level
+	gluelessEnd := rec.find(func(e Event) bool {
+		end, ok := e.(ResolveEndEvent)
+		return ok && end.QName == "ns.glue.example.com." && end.Depth == 1
+	})
+	st.Assert(t, gluelessEnd != nil, true)
+	st.Expect(t, gluelessEnd.(ResolveEndEvent).TopLevel, false)
+
+	var buf bytes.Buffer
+	st.Expect(t, m.Write(&buf), nil)
+	out := buf.String()
+	st.Expect(t, strings.Contains(out, `dnsr_resolution_duration_seconds_count{qtype="A",outcome="success"} 1`+"\n"), true)
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	m := NewMetrics()
+	m.Event(context.Background(), ResolveEndEvent{QName: "a.", QType: "A", Depth: 1, TopLevel: true, Err: ErrTimeout, Duration: 30 * time.Millisecond})
+	m.Event(context.Background(), ResolveEndEvent{QName: "a.", QType: "A", Depth: 2, Duration: time.Second})
+	var buf bytes.Buffer
+	m.Write(&buf)
+	out := buf.String()
+	st.Expect(t, strings.Contains(out, `dnsr_resolution_duration_seconds_bucket{qtype="A",outcome="timeout",le="0.025"} 0`+"\n"), true)
+	st.Expect(t, strings.Contains(out, `dnsr_resolution_duration_seconds_bucket{qtype="A",outcome="timeout",le="0.05"} 1`+"\n"), true)
+	st.Expect(t, strings.Contains(out, `dnsr_resolution_duration_seconds_sum{qtype="A",outcome="timeout"} 0.03`+"\n"), true)
+	st.Expect(t, strings.Contains(out, `dnsr_resolution_duration_seconds_count{qtype="A",outcome="timeout"} 1`+"\n"), true)
+	st.Expect(t, strings.Count(out, "dnsr_resolution_duration_seconds_count"), 1)
+	st.Expect(t, labels("a", `x"y\z`), `a="x\"y\\z"`)
+}
@@ -0,0 +1,88 @@
+package dnsr
+
+import (
+	"time"
+)
+
+// Option specifies a configuration option for a Resolver.
+type Option func(*Resolver)
+
+// WithCache specifies a cache with capacity cap.
+func WithCache(cap int) Option {
+	return func(r *Resolver) {
+		r.capacity = cap
+	}
+}
+
+// WithExpiry specifies that the Resolver will delete stale cache entries.
+func WithExpiry() Option {
+	return func(r *Resolver) {
+		r.expire = true
+	}
+}
+
+// WithTimeout specifies the timeout for network operations.
+// The default value is Timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *Resolver) {
+		r.timeout = timeout
+	}
+}
+
+// WithCaseRandomization enables DNS 0x20 encoding of outgoing queries.
+// The letters of each query name are randomly upper- or lower-cased,
+// and responses that do not echo the exact same case are rejected.
+// Some name servers do not preserve case; use with care.
+func WithCaseRandomization() Option {
+	return func(r *Resolver) {
+		r.randomizeCase = true
+	}
+}
+
+// WithMaxQueries limits the number of queries sent to name servers
+// for each call to Resolve, ResolveErr or ResolveCtx.
+// A value <= 0 removes the limit. The default value is MaxQueries.
+func WithMaxQueries(n int) Option {
+	return func(r *Resolver) {
+		r.maxQueries = n
+	}
+}
+
+// WithMaxSubResolutions limits the number of glueless name server
+// sub-resolutions for each call to Resolve, ResolveErr or ResolveCtx.
+// A value <= 0 removes the limit. The default value is MaxSubResolutions.
+func WithMaxSubResolutions(n int) Option {
+	return func(r *Resolver) {
+		r.maxSubres = n
+	}
+}
+
+// WithPriming enables root priming queries (RFC 8109). The Resolver will
+// query the root name servers in the root hints for the current set of root
+// name servers on first use, and again after each interval. If a priming
+// query fails, the root hints or previous root name servers remain in use.
+// If interval <= 0, PrimingInterval is used.
+func WithPriming(interval time.Duration) Option {
+	return func(r *Resolver) {
+		if interval <= 0 {
+			interval = PrimingInterval
+		}
+		r.priming = &priming{interval: interval}
+	}
+}
+
+// WithRootHints specifies the root hints used to find the root name servers,
+// instead of the root hints compiled into this package.
+func WithRootHints(hints *RootHints) Option {
+	return func(r *Resolver) {
+		r.hints = hints.cache
+	}
+}
+
+// WithRootZone specifies a local copy of the root zone (RFC 8806),
+// used to answer queries for TLDs instead of the root name servers.
+func WithRootZone(z *RootZone) Option {
+	return func(r *Resolver) {
+		r.rootZone = z
+	}
+}
@@ -0,0 +1,162 @@
+package dnsr
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// priming holds the root name servers learned by priming queries (RFC 8109).
+type priming struct {
+	interval time.Duration
+
+	m     sync.Mutex
+	roots *cache    // nil until primed successfully
+	next  time.Time // time of the next priming query
+	busy  bool      // a priming query is in flight
+}
+
+// primingRetry is the interval before retrying a failed priming query.
+const primingRetry = time.Minute
+
+// roots returns the cache of root name servers used by r:
+// the result of the most recent successful priming query, if any,
+// otherwise its root hints.
+func (r *Resolver) roots() *cache {
+	if r.priming != nil {
+		r.priming.m.Lock()
+		defer r.priming.m.Unlock()
+		if r.priming.roots != nil {
+			return r.priming.roots
+		}
+	}
+	return r.hints
+}
+
+// prime sends a priming query if one is due. The first priming query
+// blocks, so it can be used by the first resolution. Later priming queries
+// run in the background, while the previous root name servers remain in use.
+func (r *Resolver) prime(ctx context.Context) {
+	p := r.priming
+	if p == nil {
+		return
+	}
+	p.m.Lock()
+	now := r.clock.Now()
+	if p.busy || now.Before(p.next) {
+		p.m.Unlock()
+		return
+	}
+	p.busy = true
+	first := p.roots == nil
+	p.m.Unlock()
+
+	if first {
+		r.primeNow(ctx)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+		defer cancel()
+		r.primeNow(ctx)
+	}()
+}
+
+// primeNow queries the root name servers for the root NS records,
+// replacing the root name servers in use by r. If the query fails,
+// the previous root name servers (or root hints) remain in use.
+func (r *Resolver) primeNow(ctx context.Context) {
+	roots, err := r.queryRoots(ctx, r.hints)
+	e := PrimingEvent{Err: err}
+	if roots != nil {
+		for _, rr := range roots.get(".") {
+			e.Roots = append(e.Roots, rr.Value)
+		}
+	}
+	r.emit(ctx, e)
+	p := r.priming
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.busy = false
+	if err != nil {
+		p.next = r.clock.Now().Add(primingRetry)
+		return
+	}
+	p.roots = roots
+	p.next = r.clock.Now().Add(p.interval)
+}
+
+// queryRoots sends a priming query to each root name server in hints
+// until one succeeds, and returns a cache containing the root NS records
+// and the addresses of the root name servers. Priming queries are sent
+// like other queries, subject to hooks and the query budget in ctx.
+func (r *Resolver) queryRoots(ctx context.Context, hints *cache) (*cache, error) {
+	qmsg := &dns.Msg{}
+	qmsg.SetQuestion(".", dns.TypeNS)
+	qmsg.MsgHdr.RecursionDesired = false
+
+	err := ErrNoResponse
+	for _, nrr := range hints.get(".") {
+		if nrr.Type != "NS" {
+			continue
+		}
+		for _, arr := range hints.get(nrr.Value) {
+			if arr.Type != "A" && arr.Type != "AAAA" {
+				continue
+			}
+			var rmsg *dns.Msg
+			rmsg, err = r.query(ctx, ".", nrr.Value, arr.Value, qmsg, 0)
+			if err == ErrTimeout || budgetExceeded(err) {
+				return nil, err
+			}
+			if err != nil {
+				continue
+			}
+			var roots *cache
+			if roots, err = parsePriming(rmsg, hints); err == nil {
+				return roots, nil
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+// parsePriming parses the response to a priming query. Root name servers
+// without addresses in the additional section use the addresses in hints.
+func parsePriming(rmsg *dns.Msg, hints *cache) (*cache, error) {
+	if rmsg.Rcode != dns.RcodeSuccess || !rmsg.Authoritative {
+		return nil, ErrNoResponse
+	}
+	roots := newCache(MinCacheCapacity, false)
+	count := 0
+	for _, drr := range rmsg.Answer {
+		rr, ok := convertRR(drr, time.Time{})
+		if !ok || rr.Type != "NS" || rr.Name != "." {
+			continue
+		}
+		roots.add(rr.Name, rr)
+		count++
+	}
+	if count == 0 {
+		return nil, ErrNoResponse
+	}
+	for _, nrr := range roots.get(".") {
+		for _, drr := range rmsg.Extra {
+			rr, ok := convertRR(drr, time.Time{})
+			if ok && rr.Name == nrr.Value && (rr.Type == "A" || rr.Type == "AAAA") {
+				roots.add(rr.Name, rr)
+			}
+		}
+		if roots.get(nrr.Value) == nil {
+			for _, rr := range hints.get(nrr.Value) {
+				roots.add(rr.Name, rr)
+			}
+		}
+	}
+	return roots, nil
+}
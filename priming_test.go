@@ -0,0 +1,109 @@
+package dnsr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestPriming(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	r := newTestResolver(n, WithPriming(time.Hour))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+	st.Expect(t, root.count("."), 1)
+	roots := r.roots().get(".")
+	st.Assert(t, len(roots), 1)
+	st.Expect(t, roots[0].Value, "a.root-servers.net.")
+	st.Expect(t, r.roots().get("a.root-servers.net."), RRs{{Name: "a.root-servers.net.", Type: "A", Value: "198.41.0.4"}})
+
+	// Not due yet
+	_, err = r.ResolveErr("example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, root.count("."), 1)
+}
+
+func TestPrimingRefresh(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	r := newTestResolver(n, WithPriming(time.Hour))
+	r.prime(context.Background())
+	st.Expect(t, root.count("."), 1)
+	r.priming.m.Lock()
+	r.priming.next = time.Now().Add(-time.Second)
+	r.priming.m.Unlock()
+	r.prime(context.Background())
+	for i := 0; i < 100 && root.count(".") < 2; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	st.Expect(t, root.count("."), 2)
+}
+
+func TestPrimingFailure(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	root.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		if qmsg.Question[0].Name == "." {
+			rmsg.Rcode = dns.RcodeServerFailure
+			rmsg.Answer, rmsg.Extra = nil, nil
+		}
+		return rmsg
+	}
+	r := newTestResolver(n, WithPriming(time.Hour))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+	st.Expect(t, root.count(".") > 1, true)
+	st.Expect(t, r.roots(), rootCache)
+}
+
+func TestParsePriming(t *testing.T) {
+	rmsg := &dns.Msg{}
+	rmsg.Authoritative = true
+	for _, s := range []string{
+		". 518400 IN NS a.root-servers.net.",
+		". 518400 IN NS b.root-servers.net.",
+	} {
+		rr, _ := dns.NewRR(s)
+		rmsg.Answer = append(rmsg.Answer, rr)
+	}
+	rr, _ := dns.NewRR("a.root-servers.net. 518400 IN A 192.0.2.1")
+	rmsg.Extra = append(rmsg.Extra, rr)
+	roots, err := parsePriming(rmsg, rootCache)
+	st.Expect(t, err, nil)
+	st.Expect(t, len(roots.get(".")), 2)
+	st.Expect(t, roots.get("a.root-servers.net."), RRs{{Name: "a.root-servers.net.", Type: "A", Value: "192.0.2.1"}})
+	st.Expect(t, len(roots.get("b.root-servers.net.")) > 0, true)
+
+	rmsg.Authoritative = false
+	_, err = parsePriming(rmsg, rootCache)
+	st.Expect(t, err, ErrNoResponse)
+}
+
+func TestPrimingQuery(t *testing.T) {
+	n := newTestNet(t)
+	rec := &eventRecorder{}
+	r := newTestResolver(n, WithPriming(time.Hour), WithHook(rec))
+	_, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	e := rec.find(func(e Event) bool {
+		x, ok := e.(ExchangeSentEvent)
+		return ok && x.Query.Question[0].Name == "." && x.Query.Question[0].Qtype == dns.TypeNS
+	})
+	st.Assert(t, e != nil, true)
+	st.Expect(t, e.(ExchangeSentEvent).Zone, ".")
+	st.Expect(t, strings.HasSuffix(e.(ExchangeSentEvent).Host, ".root-servers.net."), true)
+
+	// Priming queries are charged to the budget of the first resolution
+	r = newTestResolver(n, WithPriming(time.Hour), WithMaxQueries(1))
+	_, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, ErrMaxQueries)
+	st.Expect(t, r.Stats().Queries, uint64(1))
+	st.Expect(t, len(r.roots().get(".")), 1)
+}
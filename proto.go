@@ -0,0 +1,200 @@
+package dnsr
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// ErrEncoding is returned when decoding an invalid encoding of an RR or RRs.
+var ErrEncoding = errors.New("invalid encoding of resource records")
+
+// The binary encoding of RR and RRs is Protocol Buffers, as described by:
+//
+//	message RR {
+//	  string name = 1;
+//	  string type = 2;
+//	  string value = 3;
+//	  uint64 ttl = 4;    // seconds
+//	  int64 expiry = 5;  // Unix time in nanoseconds, absent if zero
+//	  string class = 6;  // absent for IN
+//	}
+//
+//	message RRs {
+//	  repeated RR rrs = 1;
+//	}
+//
+// Unknown fields are ignored when decoding.
+const (
+	protoRRName   = 1
+	protoRRType   = 2
+	protoRRValue  = 3
+	protoRRTTL    = 4
+	protoRRExpiry = 5
+	protoRRClass  = 6
+	protoRRsRR    = 1
+)
+
+// MarshalBinary implements encoding.BinaryMarshaler, with a compact
+// Protocol Buffers encoding of rr, for example to store records in a
+// cache. The TTL is encoded in whole seconds.
+func (rr RR) MarshalBinary() ([]byte, error) {
+	return rr.appendProto(nil), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding an RR
+// encoded by MarshalBinary. A non-zero Expiry is decoded in UTC.
+func (rr *RR) UnmarshalBinary(b []byte) error {
+	var v RR
+	err := consumeProto(b, func(field int, n uint64, data []byte) {
+		switch field {
+		case protoRRName:
+			v.Name = string(data)
+		case protoRRType:
+			v.Type = string(data)
+		case protoRRValue:
+			v.Value = string(data)
+		case protoRRTTL:
+			v.TTL = time.Duration(n) * time.Second
+		case protoRRExpiry:
+			v.Expiry = time.Unix(0, int64(n)).UTC()
+		case protoRRClass:
+			v.Class = string(data)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	*rr = v
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler, encoding rrs as
+// a sequence of RRs encoded as by RR.MarshalBinary.
+func (rrs RRs) MarshalBinary() ([]byte, error) {
+	var b, rb []byte
+	for i := range rrs {
+		rb = rrs[i].appendProto(rb[:0])
+		b = appendBytesField(b, protoRRsRR, rb)
+	}
+	return b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding RRs
+// encoded by MarshalBinary. An empty encoding decodes as empty, non-nil RRs.
+func (rrs *RRs) UnmarshalBinary(b []byte) error {
+	v := RRs{}
+	var err error
+	perr := consumeProto(b, func(field int, n uint64, data []byte) {
+		if field != protoRRsRR || err != nil {
+			return
+		}
+		var rr RR
+		if err = rr.UnmarshalBinary(data); err == nil {
+			v = append(v, rr)
+		}
+	})
+	if perr != nil {
+		return perr
+	}
+	if err != nil {
+		return err
+	}
+	*rrs = v
+	return nil
+}
+
+func (rr *RR) appendProto(b []byte) []byte {
+	b = appendStringField(b, protoRRName, rr.Name)
+	b = appendStringField(b, protoRRType, rr.Type)
+	b = appendStringField(b, protoRRValue, rr.Value)
+	if ttl := uint64(rr.TTL / time.Second); ttl != 0 {
+		b = appendVarintField(b, protoRRTTL, ttl)
+	}
+	if !rr.Expiry.IsZero() {
+		b = appendVarintField(b, protoRRExpiry, uint64(rr.Expiry.UnixNano()))
+	}
+	b = appendStringField(b, protoRRClass, rr.Class)
+	return b
+}
+
+// Protocol Buffers encoding, used for dnstap messages and records.
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendVarint(b, uint64(field)<<3)
+	return appendVarint(b, v)
+}
+
+func appendFixed32Field(b []byte, field int, v uint32) []byte {
+	b = appendVarint(b, uint64(field)<<3|5)
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendStringField appends a string field, unless v is empty.
+func appendStringField(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// consumeProto calls f with each field of the Protocol Buffers message b:
+// the value of varint and fixed-size fields in n, and the contents of
+// length-delimited fields in data. It returns ErrEncoding if b is invalid.
+func consumeProto(b []byte, f func(field int, n uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, k := binary.Uvarint(b)
+		if k <= 0 || key>>3 == 0 {
+			return ErrEncoding
+		}
+		b = b[k:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			n, k := binary.Uvarint(b)
+			if k <= 0 {
+				return ErrEncoding
+			}
+			b = b[k:]
+			f(field, n, nil)
+		case 1:
+			if len(b) < 8 {
+				return ErrEncoding
+			}
+			f(field, binary.LittleEndian.Uint64(b), nil)
+			b = b[8:]
+		case 2:
+			l, k := binary.Uvarint(b)
+			if k <= 0 || l > uint64(len(b)-k) {
+				return ErrEncoding
+			}
+			f(field, 0, b[k:k+int(l)])
+			b = b[k+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return ErrEncoding
+			}
+			f(field, uint64(binary.LittleEndian.Uint32(b)), nil)
+			b = b[4:]
+		default:
+			return ErrEncoding
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package dnsr
+
+import (
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestRRsBinary(t *testing.T) {
+	b, err := goldenRRs.MarshalBinary()
+	st.Assert(t, err, nil)
+	golden(t, "rrs.pb", b)
+
+	var rrs RRs
+	st.Assert(t, rrs.UnmarshalBinary(b), nil)
+	st.Expect(t, rrs, goldenRRs)
+
+	st.Assert(t, rrs.UnmarshalBinary(nil), nil)
+	st.Expect(t, rrs, RRs{})
+}
+
+func TestRRBinary(t *testing.T) {
+	b, err := goldenRRs[0].MarshalBinary()
+	st.Assert(t, err, nil)
+	var rr RR
+	st.Assert(t, rr.UnmarshalBinary(b), nil)
+	st.Expect(t, rr, goldenRRs[0])
+
+	// Unknown fields are ignored.
+	b = appendVarintField(b, 15, 1)
+	b = appendFixed32Field(b, 16, 1)
+	st.Assert(t, rr.UnmarshalBinary(b), nil)
+	st.Expect(t, rr, goldenRRs[0])
+
+	for _, b := range [][]byte{
+		{0x0a},            // missing length
+		{0x0a, 0x05, 'a'}, // short field
+		{0x23},            // group wire type
+		{0x21, 1, 2, 3},   // short fixed64
+		{0x20, 0x80},      // truncated varint
+	} {
+		st.Expect(t, rr.UnmarshalBinary(b), ErrEncoding)
+		st.Expect(t, rr, goldenRRs[0])
+	}
+}
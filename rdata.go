@@ -0,0 +1,371 @@
+package dnsr
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RData is the typed data of a resource record, returned by RR.RData.
+// Each RData is one of the record types in this package, such as MX or SRV.
+type RData interface {
+	rdata()
+}
+
+// RData errors.
+var (
+	ErrRDataType = errors.New("unsupported record type")
+	ErrRData     = errors.New("invalid record data")
+)
+
+// A is the data of an A record.
+type A struct {
+	IP net.IP
+}
+
+// AAAA is the data of an AAAA record.
+type AAAA struct {
+	IP net.IP
+}
+
+// NS is the data of an NS record.
+type NS struct {
+	Host string
+}
+
+// CNAME is the data of a CNAME record.
+type CNAME struct {
+	Target string
+}
+
+// PTR is the data of a PTR record.
+type PTR struct {
+	Target string
+}
+
+// TXT is the data of a TXT record.
+type TXT struct {
+	Text []string
+}
+
+// MX is the data of an MX record.
+type MX struct {
+	Preference uint16
+	Exchange   string
+}
+
+// SRV is the data of an SRV record (RFC 2782).
+type SRV struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+// CAA is the data of a CAA record (RFC 8659).
+type CAA struct {
+	Flag  uint8
+	Tag   string
+	Value string
+}
+
+// NAPTR is the data of a NAPTR record (RFC 3403).
+type NAPTR struct {
+	Order       uint16
+	Preference  uint16
+	Flags       string
+	Service     string
+	Regexp      string
+	Replacement string
+}
+
+// TLSA is the data of a TLSA record (RFC 6698).
+type TLSA struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Certificate  []byte
+}
+
+// SSHFP is the data of an SSHFP record (RFC 4255).
+type SSHFP struct {
+	Algorithm   uint8
+	Type        uint8
+	Fingerprint []byte
+}
+
+// DS is the data of a DS record (RFC 4034).
+type DS struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// DNSKEY is the data of a DNSKEY record (RFC 4034).
+type DNSKEY struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+// URI is the data of a URI record (RFC 7553).
+type URI struct {
+	Priority uint16
+	Weight   uint16
+	Target   string
+}
+
+// SVCB is the data of an SVCB record (RFC 9460).
+// A Priority of 0 is AliasMode.
+type SVCB struct {
+	Priority uint16
+	Target   string
+	Params   []SVCParam
+}
+
+// HTTPS is the data of an HTTPS record (RFC 9460).
+type HTTPS struct {
+	SVCB
+}
+
+// Unknown is the data of a record of a type without a typed RData,
+// in the generic format of RFC 3597.
+type Unknown struct {
+	Type uint16
+	Data []byte
+}
+
+func (A) rdata()       {}
+func (AAAA) rdata()    {}
+func (NS) rdata()      {}
+func (CNAME) rdata()   {}
+func (PTR) rdata()     {}
+func (TXT) rdata()     {}
+func (MX) rdata()      {}
+func (SRV) rdata()     {}
+func (CAA) rdata()     {}
+func (NAPTR) rdata()   {}
+func (TLSA) rdata()    {}
+func (SSHFP) rdata()   {}
+func (DS) rdata()      {}
+func (DNSKEY) rdata()  {}
+func (URI) rdata()     {}
+func (SVCB) rdata()    {}
+func (HTTPS) rdata()   {}
+func (Unknown) rdata() {}
+
+// SVCB and HTTPS record types, unknown to package dns.
+const (
+	typeSVCB  = 64
+	typeHTTPS = 65
+)
+
+// SVCParam keys (RFC 9460).
+const (
+	SVCMandatory     = 0
+	SVCALPN          = 1
+	SVCNoDefaultALPN = 2
+	SVCPort          = 3
+	SVCIPv4Hint      = 4
+	SVCECH           = 5
+	SVCIPv6Hint      = 6
+)
+
+var svcKeyNames = map[uint16]string{
+	SVCMandatory:     "mandatory",
+	SVCALPN:          "alpn",
+	SVCNoDefaultALPN: "no-default-alpn",
+	SVCPort:          "port",
+	SVCIPv4Hint:      "ipv4hint",
+	SVCECH:           "ech",
+	SVCIPv6Hint:      "ipv6hint",
+}
+
+// SVCParam is a service parameter of an SVCB or HTTPS record,
+// with its value in wire format.
+type SVCParam struct {
+	Key   uint16
+	Value []byte
+}
+
+// KeyName returns the presentation name of the key of p, such as "alpn".
+func (p SVCParam) KeyName() string {
+	if name, ok := svcKeyNames[p.Key]; ok {
+		return name
+	}
+	return "key" + strconv.Itoa(int(p.Key))
+}
+
+// Param returns the value of the parameter key, if present.
+func (s *SVCB) Param(key uint16) ([]byte, bool) {
+	for _, p := range s.Params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ALPN returns the ALPN protocol IDs of s, such as "h2" and "h3".
+func (s *SVCB) ALPN() []string {
+	v, _ := s.Param(SVCALPN)
+	var ids []string
+	for len(v) > 0 && int(v[0]) < len(v) {
+		ids = append(ids, string(v[1:1+v[0]]))
+		v = v[1+v[0]:]
+	}
+	return ids
+}
+
+// Port returns the port of s, if present.
+func (s *SVCB) Port() (uint16, bool) {
+	v, ok := s.Param(SVCPort)
+	if !ok || len(v) != 2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(v), true
+}
+
+// IPHints returns the IPv4 and IPv6 address hints of s.
+func (s *SVCB) IPHints() []net.IP {
+	var ips []net.IP
+	for _, h := range []struct {
+		key  uint16
+		size int
+	}{{SVCIPv4Hint, net.IPv4len}, {SVCIPv6Hint, net.IPv6len}} {
+		v, _ := s.Param(h.key)
+		for ; len(v) >= h.size; v = v[h.size:] {
+			ips = append(ips, net.IP(append([]byte(nil), v[:h.size]...)))
+		}
+	}
+	return ips
+}
+
+// RData parses the Value of rr into typed record data. It returns
+// ErrRDataType if the type of rr has no typed RData, and ErrRData
+// if Value cannot be parsed. The data of SOA records is not kept in
+// Value, so they are not supported.
+func (rr *RR) RData() (RData, error) {
+	switch rr.Type {
+	case "A", "AAAA":
+		ip := net.ParseIP(rr.Value)
+		if ip == nil {
+			return nil, ErrRData
+		}
+		if rr.Type == "A" {
+			return A{ip}, nil
+		}
+		return AAAA{ip}, nil
+	case "NS":
+		return NS{rr.Value}, nil
+	case "CNAME":
+		return CNAME{rr.Value}, nil
+	case "TXT":
+		return TXT{rr.TXTSegments()}, nil
+	case "SOA":
+		return nil, ErrRDataType
+	}
+	if strings.HasPrefix(rr.Type, "TYPE") {
+		return parseUnknown(rr)
+	}
+	drr, err := dns.NewRR(". 0 IN " + rr.Type + " " + rr.Value)
+	if err != nil || drr == nil {
+		return nil, ErrRData
+	}
+	switch t := drr.(type) {
+	case *dns.PTR:
+		return PTR{t.Ptr}, nil
+	case *dns.MX:
+		return MX{t.Preference, t.Mx}, nil
+	case *dns.SRV:
+		return SRV{t.Priority, t.Weight, t.Port, t.Target}, nil
+	case *dns.CAA:
+		return CAA{t.Flag, t.Tag, t.Value}, nil
+	case *dns.NAPTR:
+		return NAPTR{t.Order, t.Preference, t.Flags, t.Service, t.Regexp, t.Replacement}, nil
+	case *dns.TLSA:
+		return TLSA{t.Usage, t.Selector, t.MatchingType, decodeHex(t.Certificate)}, nil
+	case *dns.SSHFP:
+		return SSHFP{t.Algorithm, t.Type, decodeHex(t.FingerPrint)}, nil
+	case *dns.DS:
+		return DS{t.KeyTag, t.Algorithm, t.DigestType, decodeHex(t.Digest)}, nil
+	case *dns.DNSKEY:
+		key, _ := base64.StdEncoding.DecodeString(t.PublicKey)
+		return DNSKEY{t.Flags, t.Protocol, t.Algorithm, key}, nil
+	case *dns.URI:
+		return URI{t.Priority, t.Weight, t.Target}, nil
+	}
+	return nil, ErrRDataType
+}
+
+func decodeHex(s string) []byte {
+	b, _ := hex.DecodeString(s)
+	return b
+}
+
+// parseUnknown parses the value of rr in the generic format of RFC 3597
+// (\# length hex), used for types unknown to package dns, such as SVCB
+// and HTTPS.
+func parseUnknown(rr *RR) (RData, error) {
+	t, err := strconv.ParseUint(strings.TrimPrefix(rr.Type, "TYPE"), 10, 16)
+	if err != nil {
+		return nil, ErrRDataType
+	}
+	fields := strings.Fields(rr.Value)
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, ErrRData
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, ErrRData
+	}
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil || len(data) != n {
+		return nil, ErrRData
+	}
+	switch t {
+	case typeSVCB:
+		return parseSVCB(data)
+	case typeHTTPS:
+		s, err := parseSVCB(data)
+		if err != nil {
+			return nil, err
+		}
+		return HTTPS{s}, nil
+	}
+	return Unknown{uint16(t), data}, nil
+}
+
+// parseSVCB parses SVCB record data in wire format.
+func parseSVCB(data []byte) (SVCB, error) {
+	var s SVCB
+	if len(data) < 2 {
+		return s, ErrRData
+	}
+	s.Priority = binary.BigEndian.Uint16(data)
+	target, off, err := dns.UnpackDomainName(data, 2)
+	if err != nil {
+		return s, ErrRData
+	}
+	s.Target = target
+	for data = data[off:]; len(data) > 0; {
+		if len(data) < 4 {
+			return s, ErrRData
+		}
+		key, n := binary.BigEndian.Uint16(data), int(binary.BigEndian.Uint16(data[2:]))
+		if len(data) < 4+n {
+			return s, ErrRData
+		}
+		s.Params = append(s.Params, SVCParam{key, data[4 : 4+n]})
+		data = data[4+n:]
+	}
+	return s, nil
+}
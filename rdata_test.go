@@ -0,0 +1,96 @@
+package dnsr
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// newRR converts a record in zone-file format to an RR.
+func newRR(t *testing.T, s string) RR {
+	drr, err := dns.NewRR(s)
+	st.Assert(t, err, nil)
+	rr, ok := convertRR(drr, time.Time{})
+	st.Assert(t, ok, true)
+	return rr
+}
+
+func TestRData(t *testing.T) {
+	tests := []struct {
+		rr   string
+		want RData
+	}{
+		{"example.com. 300 IN A 192.0.2.1", A{net.ParseIP("192.0.2.1")}},
+		{"example.com. 300 IN AAAA 2001:db8::1", AAAA{net.ParseIP("2001:db8::1")}},
+		{"example.com. 300 IN NS ns1.example.com.", NS{"ns1.example.com."}},
+		{"www.example.com. 300 IN CNAME example.com.", CNAME{"example.com."}},
+		{"1.2.0.192.in-addr.arpa. 300 IN PTR host.example.com.", PTR{"host.example.com."}},
+		{`example.com. 300 IN TXT "v=spf1 -all"`, TXT{[]string{"v=spf1 -all"}}},
+		{"example.com. 300 IN MX 10 mail.example.com.", MX{10, "mail.example.com."}},
+		{"_sip._tcp.example.com. 300 IN SRV 10 20 5060 sip.example.com.", SRV{10, 20, 5060, "sip.example.com."}},
+		{`example.com. 300 IN CAA 0 issue "letsencrypt.org"`, CAA{0, "issue", "letsencrypt.org"}},
+		{`example.com. 300 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`, NAPTR{100, 10, "S", "SIP+D2U", "", "_sip._udp.example.com."}},
+		{"_443._tcp.example.com. 300 IN TLSA 3 1 1 0d6fce3375", TLSA{3, 1, 1, []byte{0x0d, 0x6f, 0xce, 0x33, 0x75}}},
+		{"example.com. 300 IN SSHFP 4 2 8e1f", SSHFP{4, 2, []byte{0x8e, 0x1f}}},
+		{"example.com. 300 IN DS 12345 13 2 c0ffee", DS{12345, 13, 2, []byte{0xc0, 0xff, 0xee}}},
+		{"example.com. 300 IN DNSKEY 257 3 13 AQID", DNSKEY{257, 3, 13, []byte{1, 2, 3}}},
+		{`_http._tcp.example.com. 300 IN URI 10 1 "https://example.com/"`, URI{10, 1, "https://example.com/"}},
+	}
+	for _, tt := range tests {
+		rr := newRR(t, tt.rr)
+		rdata, err := rr.RData()
+		st.Expect(t, err, nil)
+		st.Expect(t, rdata, tt.want)
+	}
+}
+
+func TestRDataHTTPS(t *testing.T) {
+	// 1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1
+	rr := newRR(t, `example.com. 300 IN TYPE65 \# 27 000100000100060268320268330003000220fb00040004c0000201`)
+	st.Expect(t, rr.Type, "TYPE65")
+	rdata, err := rr.RData()
+	st.Assert(t, err, nil)
+	https, ok := rdata.(HTTPS)
+	st.Assert(t, ok, true)
+	st.Expect(t, https.Priority, uint16(1))
+	st.Expect(t, https.Target, ".")
+	st.Expect(t, len(https.Params), 3)
+	st.Expect(t, https.Params[0].KeyName(), "alpn")
+	st.Expect(t, https.ALPN(), []string{"h2", "h3"})
+	port, ok := https.Port()
+	st.Expect(t, ok, true)
+	st.Expect(t, port, uint16(8443))
+	st.Expect(t, https.IPHints(), []net.IP{net.ParseIP("192.0.2.1").To4()})
+
+	// 0 svc.example.net.
+	rr = newRR(t, `example.com. 300 IN TYPE64 \# 19 0000 03737663076578616d706c65036e657400`)
+	rdata, err = rr.RData()
+	st.Assert(t, err, nil)
+	st.Expect(t, rdata, SVCB{Target: "svc.example.net."})
+
+	rr = newRR(t, `example.com. 300 IN TYPE65 \# 5 0001000001`)
+	_, err = rr.RData()
+	st.Expect(t, err, ErrRData)
+}
+
+func TestRDataErrors(t *testing.T) {
+	rr := newRR(t, `example.com. 300 IN TYPE999 \# 2 abcd`)
+	rdata, err := rr.RData()
+	st.Expect(t, err, nil)
+	st.Expect(t, rdata, Unknown{999, []byte{0xab, 0xcd}})
+
+	rr = newRR(t, "example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 2 3 4 5")
+	_, err = rr.RData()
+	st.Expect(t, err, ErrRDataType)
+
+	rr = RR{Name: "example.com.", Type: "MX", Value: "mail.example.com."}
+	_, err = rr.RData()
+	st.Expect(t, err, ErrRData)
+
+	rr = RR{Name: "example.com.", Type: "A", Value: "bogus"}
+	_, err = rr.RData()
+	st.Expect(t, err, ErrRData)
+}
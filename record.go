@@ -0,0 +1,189 @@
+package dnsr
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RecordedExchange is a query to a name server and its response,
+// in wire format, or the error if the query failed.
+type RecordedExchange struct {
+	Zone     string        `json:"zone"`
+	Host     string        `json:"host"`
+	Addr     string        `json:"addr"`
+	Query    []byte        `json:"query"`
+	Response []byte        `json:"response,omitempty"`
+	RTT      time.Duration `json:"rtt_ns"`
+	Err      string        `json:"error,omitempty"`
+}
+
+// ErrNotRecorded is returned when replaying a query that is not in a Recording.
+var ErrNotRecorded = errors.New("query not recorded")
+
+// Recorder is a Hook that records each query to a name server and its
+// response, as JSON lines of RecordedExchange, for replay with WithReplay.
+// Safe for concurrent usage.
+type Recorder struct {
+	m   sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder that writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing a recorded exchange, if any.
+func (rec *Recorder) Err() error {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	return rec.err
+}
+
+// Event implements Hook.
+func (rec *Recorder) Event(ctx context.Context, e Event) {
+	switch e := e.(type) {
+	case ExchangeReceivedEvent:
+		rec.record(e.Zone, e.Host, e.Addr, e.Query, e.Response, e.Duration, e.Err)
+	case ExchangeCancelledEvent:
+		var err error
+		if e.Response == nil {
+			err = context.Canceled
+		}
+		rec.record(e.Zone, e.Host, e.Addr, e.Query, e.Response, e.Duration, err)
+	}
+}
+
+func (rec *Recorder) record(zone, host, addr string, qmsg, rmsg *dns.Msg, rtt time.Duration, err error) {
+	x := RecordedExchange{Zone: zone, Host: host, Addr: addr, RTT: rtt}
+	var perr error
+	if x.Query, perr = qmsg.Pack(); perr != nil {
+		return
+	}
+	if rmsg != nil {
+		if x.Response, perr = rmsg.Pack(); perr != nil {
+			err = perr
+		}
+	}
+	if isTimeout(err) {
+		err = ErrTimeout
+	}
+	x.Err = errString(err)
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	if rec.err == nil {
+		rec.err = rec.enc.Encode(&x)
+	}
+}
+
+// Recording is a set of exchanges recorded by a Recorder. A Resolver with
+// WithReplay answers queries from a Recording instead of querying name
+// servers, to reproduce a resolution deterministically. Queries are matched
+// by zone and question, not by name server, since a Resolver chooses
+// name servers at random.
+type Recording struct {
+	m         sync.Mutex
+	exchanges map[string][]*RecordedExchange // by replayKey
+}
+
+// ReadRecording reads a Recording written by a Recorder.
+func ReadRecording(r io.Reader) (*Recording, error) {
+	rec := &Recording{exchanges: make(map[string][]*RecordedExchange)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		x := &RecordedExchange{}
+		if err := json.Unmarshal(scanner.Bytes(), x); err != nil {
+			return nil, err
+		}
+		qmsg := &dns.Msg{}
+		if err := qmsg.Unpack(x.Query); err != nil {
+			return nil, err
+		}
+		key := replayKey(x.Zone, qmsg)
+		rec.exchanges[key] = append(rec.exchanges[key], x)
+	}
+	return rec, scanner.Err()
+}
+
+// WithReplay specifies a Recording that answers all queries
+// to name servers, including upstream name servers.
+func WithReplay(rec *Recording) Option {
+	return func(r *Resolver) {
+		r.replay = rec
+	}
+}
+
+// replayKey returns the key of a query to a name server for zone: the zone
+// and the question, ignoring case, since the case of the question can be
+// randomized.
+func replayKey(zone string, qmsg *dns.Msg) string {
+	if len(qmsg.Question) != 1 {
+		return zone
+	}
+	q := qmsg.Question[0]
+	return toLowerFQDN(zone) + " " + strings.ToLower(q.Name) + " " + dns.TypeToString[q.Qtype] + " " + dns.ClassToString[q.Qclass]
+}
+
+// zone returns an exchanger that replays queries to name servers for zone.
+func (rec *Recording) zone(zone string) exchanger {
+	return replayExchanger{rec, zone}
+}
+
+// replayExchanger replays queries to name servers for a zone.
+type replayExchanger struct {
+	rec  *Recording
+	zone string
+}
+
+// exchange implements exchanger. Recorded exchanges of the same query are
+// replayed in order, repeating the last. Responses are modified to match
+// the ID and question of qmsg.
+func (rx replayExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	rec := rx.rec
+	key := replayKey(rx.zone, qmsg)
+	rec.m.Lock()
+	xs := rec.exchanges[key]
+	if len(xs) > 1 {
+		rec.exchanges[key] = xs[1:]
+	}
+	rec.m.Unlock()
+	if len(xs) == 0 {
+		return nil, 0, ErrNotRecorded
+	}
+	x := xs[0]
+	var err error
+	switch x.Err {
+	case "":
+	case ErrTimeout.Error():
+		err = ErrTimeout
+	case context.Canceled.Error():
+		err = context.Canceled
+	default:
+		err = errors.New(x.Err)
+	}
+	if x.Response == nil {
+		return nil, x.RTT, err
+	}
+	rmsg := &dns.Msg{}
+	if uerr := rmsg.Unpack(x.Response); uerr != nil {
+		return nil, x.RTT, uerr
+	}
+	rmsg.Id = qmsg.Id
+	if len(rmsg.Question) == 1 && len(qmsg.Question) == 1 && strings.EqualFold(rmsg.Question[0].Name, qmsg.Question[0].Name) {
+		rmsg.Question[0].Name = qmsg.Question[0].Name
+	}
+	return rmsg, x.RTT, err
+}
@@ -0,0 +1,52 @@
+package dnsr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestRecordReplay(t *testing.T) {
+	buf := &lockedBuffer{}
+	rec := NewRecorder(buf)
+	r := newTestResolver(newTestNet(t), WithCaseRandomization(), WithHook(rec))
+	want, err := r.ResolveErr("www.example.com", "A")
+	st.Assert(t, err, nil)
+	st.Expect(t, len(want), 1)
+	_, err = r.ResolveErr("nope.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, rec.Err(), nil)
+
+	recording, err := ReadRecording(strings.NewReader(buf.String()))
+	st.Assert(t, err, nil)
+	n := newTestNet(t)
+	r = newTestResolver(n, WithCaseRandomization(), WithReplay(recording))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, want)
+	_, err = r.ResolveErr("nope.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, n.server("192.0.2.53").count("www.example.com."), 0)
+
+	rrs, _ = r.ResolveErr("www.example.com", "TXT")
+	st.Expect(t, len(rrs), 0)
+	st.Expect(t, n.server("192.0.2.53").count("www.example.com."), 0)
+}
+
+func TestReplayOrder(t *testing.T) {
+	const recording = `
+{"zone":"example.com.","host":"ns1.example.com.","addr":"192.0.2.53:53","query":"AAEBAAABAAAAAAAAA3d3dwdleGFtcGxlA2NvbQAAAQAB","rtt_ns":0,"error":"timeout expired"}
+{"zone":"example.com.","host":"ns1.example.com.","addr":"192.0.2.53:53","query":"AAEBAAABAAAAAAAAA3d3dwdleGFtcGxlA2NvbQAAAQAB","response":"AAGFAAABAAEAAAAAA3d3dwdleGFtcGxlA2NvbQAAAQABA3d3dwdleGFtcGxlA2NvbQAAAQABAAAOEAAEwAACAg==","rtt_ns":1000000}
+`
+	rec, err := ReadRecording(strings.NewReader(recording))
+	st.Assert(t, err, nil)
+	r := newTestResolver(newTestNet(t), WithForwardZone("example.com", "192.0.2.53"), WithReplay(rec))
+	_, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err != nil, true)
+	for i := 0; i < 2; i++ {
+		rrs, err := r.ResolveErr("WWW.example.com", "A")
+		st.Expect(t, err, nil)
+		st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "A", Value: "192.0.2.2", TTL: rrs[0].TTL}})
+	}
+}
@@ -0,0 +1,202 @@
+package dnsr
+
+import (
+	"context"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// delegation is the set of name servers for a zone cut,
+// as parsed from a referral response.
+type delegation struct {
+	zone        string
+	nameservers []nameserver
+}
+
+// nameserver is a name server host name and its known IP addresses.
+// A nameserver without addresses is glueless. Its hints are addresses from
+// out-of-bailiwick glue, which are never cached, and are tried before the
+// addresses of a glueless name server are resolved.
+type nameserver struct {
+	host  string
+	addrs []string
+	hints []string
+}
+
+// parseReferral parses a referral from a name server for zone into a
+// delegation. NS records in the authority section must delegate to a zone
+// cut below zone and at or above qname. A and AAAA records in the additional
+// section are used as glue only if they are within zone; glue outside of
+// zone is kept only as hints for a name server treated as glueless.
+// It returns nil if rmsg is not a valid referral.
+func parseReferral(rmsg *dns.Msg, zone, qname string) *delegation {
+	if !isReferral(rmsg) {
+		return nil
+	}
+	var d *delegation
+	for _, drr := range rmsg.Ns {
+		ns, ok := drr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		cut := toLowerFQDN(ns.Hdr.Name)
+		if !isZoneCut(cut, zone, qname) {
+			continue
+		}
+		if d == nil {
+			d = &delegation{zone: cut}
+		} else if cut != d.zone {
+			continue
+		}
+		d.nameservers = append(d.nameservers, nameserver{host: toLowerFQDN(ns.Ns)})
+	}
+	if d == nil {
+		return nil
+	}
+	for _, drr := range rmsg.Extra {
+		var addr string
+		switch t := drr.(type) {
+		case *dns.A:
+			addr = t.A.String()
+		case *dns.AAAA:
+			addr = t.AAAA.String()
+		default:
+			continue
+		}
+		host := toLowerFQDN(drr.Header().Name)
+		glue := inBailiwick(host, zone)
+		for i := range d.nameservers {
+			switch {
+			case d.nameservers[i].host != host:
+			case glue:
+				d.nameservers[i].addrs = append(d.nameservers[i].addrs, addr)
+			default:
+				d.nameservers[i].hints = append(d.nameservers[i].hints, addr)
+			}
+		}
+	}
+	return d
+}
+
+type delegationsKey struct{}
+
+// delegations are the delegations received in referrals during a single
+// top-level resolution, by zone. Safe for concurrent usage.
+type delegations struct {
+	m     sync.Mutex
+	zones map[string]*delegation
+}
+
+// withDelegations returns a copy of ctx that keeps the delegations
+// received in referrals.
+func withDelegations(ctx context.Context) context.Context {
+	return context.WithValue(ctx, delegationsKey{}, &delegations{zones: make(map[string]*delegation)})
+}
+
+// addDelegation keeps d in ctx, if ctx keeps delegations.
+func addDelegation(ctx context.Context, d *delegation) {
+	ds, _ := ctx.Value(delegationsKey{}).(*delegations)
+	if ds == nil {
+		return
+	}
+	ds.m.Lock()
+	defer ds.m.Unlock()
+	ds.zones[d.zone] = d
+}
+
+// delegationFor returns the delegation for zone kept in ctx, or nil.
+func delegationFor(ctx context.Context, zone string) *delegation {
+	ds, _ := ctx.Value(delegationsKey{}).(*delegations)
+	if ds == nil {
+		return nil
+	}
+	ds.m.Lock()
+	defer ds.m.Unlock()
+	return ds.zones[zone]
+}
+
+// nameservers returns the name servers for zone. If a referral to zone
+// was received during this resolution, its name servers and glue are
+// used. Otherwise the name servers are the NS records in nrrs. Name
+// servers without glue get any IP addresses known from the cache.
+// It does not query the network.
+func (r *Resolver) nameservers(ctx context.Context, zone string, nrrs RRs) []nameserver {
+	var nss []nameserver
+	if d := delegationFor(ctx, zone); d != nil {
+		nss = append(nss, d.nameservers...)
+	} else {
+		for _, nrr := range nrrs {
+			if nrr.Type == "NS" && nrr.Name == zone {
+				nss = append(nss, nameserver{host: nrr.Value})
+			}
+		}
+	}
+	for i := range nss {
+		if len(nss[i].addrs) > 0 {
+			continue
+		}
+		var addrs []string
+		for _, qtype := range []string{"A", "AAAA"} {
+			arrs, _ := r.cacheGet(ctx, nss[i].host, qtype)
+			for _, arr := range arrs {
+				addrs = append(addrs, arr.Value)
+			}
+		}
+		nss[i].addrs = addrs
+	}
+	return nss
+}
+
+type gluelessKey struct{}
+
+// resolveGlueless resolves the IP addresses of a glueless name server host.
+// This is a separate sub-resolution with its own recursion depth budget.
+// Sub-resolutions are charged to the budget of the top-level resolution.
+// Nested sub-resolutions are limited to MaxGlueless, and a name server
+// that depends on its own resolution fails immediately.
+func (r *Resolver) resolveGlueless(ctx context.Context, host string) ([]string, error) {
+	chain, _ := ctx.Value(gluelessKey{}).([]string)
+	for _, h := range chain {
+		if h == host {
+			return nil, ErrGluelessLoop
+		}
+	}
+	if len(chain) >= MaxGlueless {
+		return nil, ErrMaxGlueless
+	}
+	if err := r.spendSubresolution(ctx); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, gluelessKey{}, append(chain[:len(chain):len(chain)], host))
+
+	// Resolve AAAA records only for name servers without A records
+	var addrs []string
+	for _, qtype := range []string{"A", "AAAA"} {
+		arrs, err := r.resolve(ctx, host, qtype, 0)
+		if err == NXDOMAIN {
+			return nil, ErrNoARecords // qname may still exist
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, arr := range arrs {
+			if arr.Type == qtype {
+				addrs = append(addrs, arr.Value)
+			}
+		}
+		if len(addrs) > 0 {
+			return addrs, nil
+		}
+	}
+	return nil, ErrNoARecords
+}
+
+// event returns a ReferralEvent for d, received from host.
+func (d *delegation) event(host string, depth int) ReferralEvent {
+	e := ReferralEvent{Host: host, Zone: d.zone, Depth: depth, NameServers: make([]NameServer, len(d.nameservers))}
+	for i, ns := range d.nameservers {
+		e.NameServers[i] = NameServer{Host: ns.host, Addrs: ns.addrs}
+	}
+	return e
+}
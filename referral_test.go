@@ -0,0 +1,146 @@
+package dnsr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestParseReferral(t *testing.T) {
+	rmsg := &dns.Msg{}
+	for _, s := range []string{
+		"example.com. 172800 IN NS ns1.example.com.",
+		"example.com. 172800 IN NS ns2.example.net.",
+		"com. 172800 IN NS ns.evil.com.",
+	} {
+		rr, _ := dns.NewRR(s)
+		rmsg.Ns = append(rmsg.Ns, rr)
+	}
+	for _, s := range []string{
+		"ns1.example.com. 172800 IN A 192.0.2.53",
+		"ns1.example.com. 172800 IN AAAA 2001:db8::53",
+		"ns2.example.net. 172800 IN A 198.51.100.53",
+	} {
+		rr, _ := dns.NewRR(s)
+		rmsg.Extra = append(rmsg.Extra, rr)
+	}
+	d := parseReferral(rmsg, "com.", "www.example.com.")
+	st.Assert(t, d != nil, true)
+	st.Expect(t, d.zone, "example.com.")
+	st.Expect(t, d.nameservers, []nameserver{
+		{host: "ns1.example.com.", addrs: []string{"192.0.2.53", "2001:db8::53"}},
+		{host: "ns2.example.net.", hints: []string{"198.51.100.53"}},
+	})
+
+	st.Expect(t, parseReferral(rmsg, "example.com.", "www.example.com."), (*delegation)(nil))
+	rmsg.Authoritative = true
+	st.Expect(t, parseReferral(rmsg, "com.", "www.example.com."), (*delegation)(nil))
+}
+
+func TestGlue(t *testing.T) {
+	n := newTestNet(t)
+	r := newTestResolver(n)
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+	st.Expect(t, n.server("192.0.2.53").count("ns1.example.com."), 0)
+	st.Expect(t, n.server("192.5.6.30").count("ns1.example.com."), 0)
+}
+
+func TestGlueless(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.5.6.30").add(t, `
+glueless.com.           IN NS  ns.glue.example.com.
+`)
+	n.server("192.0.2.53").add(t, `
+ns.glue.example.com.    IN A   203.0.113.53
+`)
+	n.add(t, `
+glueless.com.           IN SOA ns.glue.example.com. hostmaster.glueless.com. 1 1800 900 604800 300
+glueless.com.           IN NS  ns.glue.example.com.
+www.glueless.com.       IN A   203.0.113.80
+`, "203.0.113.53")
+	r := newTestResolver(n)
+	rrs, err := r.ResolveErr("www.glueless.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "203.0.113.80" }), 1)
+	st.Expect(t, n.server("192.0.2.53").count("ns.glue.example.com.") > 0, true)
+}
+
+func TestGlueHints(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.5.6.30").add(t, `
+hinted.com.             IN NS  ns.hinted.net.
+ns.hinted.net.          IN A   203.0.113.54
+`)
+	hinted := n.add(t, `
+hinted.com.             IN SOA ns.hinted.net. hostmaster.hinted.com. 1 1800 900 604800 300
+hinted.com.             IN NS  ns.hinted.net.
+www.hinted.com.         IN A   203.0.113.81
+`, "203.0.113.54")
+	r := newTestResolver(n)
+	rrs, err := r.ResolveErr("www.hinted.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "203.0.113.81" }), 1)
+	st.Expect(t, hinted.count("www.hinted.com.") > 0, true)
+
+	// The hint is not cached, and the name server was not resolved
+	st.Expect(t, r.cache.get("ns.hinted.net.") == nil, true)
+	st.Expect(t, r.Stats().OutOfBailiwick > 0, true)
+	st.Expect(t, n.server("198.41.0.4").count("ns.hinted.net."), 0)
+}
+
+func TestGluelessLoop(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.5.6.30").add(t, `
+loop.com.               IN NS  ns.loop.com.
+`)
+	r := newTestResolver(n)
+	rrs, _ := r.ResolveErr("www.loop.com", "A")
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 0)
+	st.Expect(t, n.server("192.5.6.30").count("ns.loop.com.") <= MaxRecursion, true)
+
+	_, err := r.resolveGlueless(context.WithValue(context.Background(), gluelessKey{}, []string{"ns.loop.com."}), "ns.loop.com.")
+	st.Expect(t, err, ErrGluelessLoop)
+}
+
+func TestReferralNameservers(t *testing.T) {
+	r := New(0)
+	ctx := withDelegations(context.Background())
+	nrrs := RRs{{Name: "example.com.", Type: "NS", Value: "ns1.example.com."}}
+	st.Expect(t, r.nameservers(ctx, "example.com.", nrrs), []nameserver{{host: "ns1.example.com."}})
+
+	// Glue from a referral is used directly, not read from the cache
+	addDelegation(ctx, &delegation{zone: "example.com.", nameservers: []nameserver{
+		{host: "ns1.example.com.", addrs: []string{"192.0.2.53"}},
+		{host: "ns2.example.com."},
+	}})
+	r.cache.add("ns2.example.com.", RR{Name: "ns2.example.com.", Type: "AAAA", Value: "2001:db8::53"})
+	st.Expect(t, r.nameservers(ctx, "example.com.", nrrs), []nameserver{
+		{host: "ns1.example.com.", addrs: []string{"192.0.2.53"}},
+		{host: "ns2.example.com.", addrs: []string{"2001:db8::53"}},
+	})
+	st.Expect(t, delegationFor(ctx, "example.com.").nameservers[1].addrs, []string(nil))
+}
+
+func TestGluelessAAAA(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.5.6.30").add(t, `
+v6only.com.             IN NS  ns6.example.com.
+`)
+	n.server("192.0.2.53").add(t, `
+ns6.example.com.        IN AAAA 2001:db8::53
+`)
+	n.add(t, `
+v6only.com.             IN SOA ns6.example.com. hostmaster.v6only.com. 1 1800 900 604800 300
+v6only.com.             IN NS  ns6.example.com.
+www.v6only.com.         IN A   203.0.113.80
+`, "2001:db8::53")
+	r := newTestResolver(n)
+	rrs, err := r.ResolveErr("www.v6only.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "203.0.113.80" }), 1)
+	st.Expect(t, n.server("2001:db8::53").count("www.v6only.com.") > 0, true)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
@@ -16,6 +17,11 @@ var (
 	MaxRecursion        = 10
 	MaxNameservers      = 4
 	MaxIPs              = 2
+	MaxGlueless         = 3
+	MaxQueries          = 100
+	MaxSubResolutions   = 10
+	LameDuration        = 10 * time.Minute
+	PrimingInterval     = 24 * time.Hour
 )
 
 // Resolver errors.
@@ -25,45 +31,86 @@ var (
 	ErrMaxRecursion = fmt.Errorf("maximum recursion depth reached: %d", MaxRecursion)
 	ErrMaxIPs       = fmt.Errorf("maximum name server IPs queried: %d", MaxIPs)
 	ErrNoARecords   = fmt.Errorf("no A records found for name server")
+	ErrMaxGlueless  = fmt.Errorf("maximum glueless name server resolutions reached: %d", MaxGlueless)
+	ErrGluelessLoop = fmt.Errorf("glueless name server depends on itself")
+	ErrMaxQueries   = fmt.Errorf("maximum queries per resolution exceeded")
+	ErrLame         = fmt.Errorf("lame delegation")
 	ErrNoResponse   = fmt.Errorf("no responses received")
 	ErrTimeout      = fmt.Errorf("timeout expired") // TODO: Timeouter interface? e.g. func (e) Timeout() bool { return true }
+	ErrUnknownClass = fmt.Errorf("unknown DNS class")
+
+	ErrMaxSubResolutions = fmt.Errorf("maximum glueless name server sub-resolutions per resolution exceeded")
+
+	ErrIDMismatch       = fmt.Errorf("response ID does not match query")
+	ErrQuestionMismatch = fmt.Errorf("response question does not match query")
+	ErrCaseMismatch     = fmt.Errorf("response question does not match query case")
 )
 
 // Resolver implements a primitive, non-recursive, caching DNS resolver.
 type Resolver struct {
-	cache   *cache
-	expire  bool
-	timeout time.Duration
+	stats         Stats // first for 64-bit alignment of atomic counters
+	cache         *cache
+	hints         *cache
+	rootZone      *RootZone
+	local         []*LocalRecords
+	policies      []*PolicyZone
+	policyHook    func(PolicyHit)
+	hooks         []Hook
+	tracer        Tracer
+	replay        *Recording
+	clock         Clock
+	zones         map[string]*zoneConfig
+	lame          *lameServers
+	priming       *priming
+	capacity      int
+	expire        bool
+	timeout       time.Duration
+	randomizeCase bool
+	maxQueries    int
+	maxSubres     int
+	exchanger     exchanger
+}
+
+// NewResolver returns an initialized Resolver with options.
+// By default, the returned Resolver will have cache capacity 0
+// (MinCacheCapacity) and the package-level Timeout, MaxQueries and
+// MaxSubResolutions.
+func NewResolver(options ...Option) *Resolver {
+	r := &Resolver{
+		timeout:    Timeout,
+		maxQueries: MaxQueries,
+		maxSubres:  MaxSubResolutions,
+		hints:      rootCache,
+		lame:       newLameServers(),
+		exchanger:  udpExchanger{},
+		clock:      systemClock{},
+	}
+	for _, o := range options {
+		o(r)
+	}
+	r.cache = newCache(r.capacity, r.expire)
+	r.cache.clock = r.clock
+	return r
 }
 
 // New initializes a Resolver with the specified cache size.
 func New(capacity int) *Resolver {
-	return NewWithTimeout(capacity, Timeout)
+	return NewResolver(WithCache(capacity))
 }
 
 // NewWithTimeout initializes a Resolver with the specified cache size and resolution timeout.
 func NewWithTimeout(capacity int, timeout time.Duration) *Resolver {
-	r := &Resolver{
-		cache:   newCache(capacity, false),
-		expire:  false,
-		timeout: timeout,
-	}
-	return r
+	return NewResolver(WithCache(capacity), WithTimeout(timeout))
 }
 
 // NewExpiring initializes an expiring Resolver with the specified cache size.
 func NewExpiring(capacity int) *Resolver {
-	return NewExpiringWithTimeout(capacity, Timeout)
+	return NewResolver(WithCache(capacity), WithExpiry())
 }
 
 // NewExpiringWithTimeout initializes an expiring Resolved with the specified cache size and resolution timeout.
 func NewExpiringWithTimeout(capacity int, timeout time.Duration) *Resolver {
-	r := &Resolver{
-		cache:   newCache(capacity, true),
-		expire:  true,
-		timeout: timeout,
-	}
-	return r
+	return NewResolver(WithCache(capacity), WithExpiry(), WithTimeout(timeout))
 }
 
 // Resolve calls ResolveErr to find DNS records of type qtype for the domain qname.
@@ -84,50 +131,111 @@ func (r *Resolver) Resolve(qname, qtype string) RRs {
 // Specify an empty string in qtype to receive any DNS records found
 // (currently A, AAAA, NS, CNAME, SOA, and TXT).
 func (r *Resolver) ResolveErr(qname, qtype string) (RRs, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
-	defer cancel()
-	return r.resolve(ctx, toLowerFQDN(qname), qtype, 0)
+	return r.ResolveCtx(context.Background(), qname, qtype)
 }
 
 // ResolveCtx finds DNS records of type qtype for the domain qname using
 // the supplied context. Requests may time out earlier if timeout is
 // shorter than a deadline set in ctx.
+// Each call may send at most MaxQueries queries to name servers
+// (see WithMaxQueries), otherwise it will return ErrMaxQueries, and resolve
+// at most MaxSubResolutions glueless name servers (see WithMaxSubResolutions),
+// otherwise it will return ErrMaxSubResolutions.
 // For nonexistent domains, it will return an NXDOMAIN error.
 // Specify an empty string in qtype to receive any DNS records found
 // (currently A, AAAA, NS, CNAME, SOA, and TXT).
+// Records are resolved in class IN; see ResolveClassCtx for other classes.
 func (r *Resolver) ResolveCtx(ctx context.Context, qname, qtype string) (RRs, error) {
-	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	ctx, cancel := r.newResolution(ctx)
 	defer cancel()
+	ctx = withTopLevel(ctx)
+	if len(r.policies) > 0 {
+		return r.resolvePolicy(ctx, toLowerFQDN(qname), qtype)
+	}
 	return r.resolve(ctx, toLowerFQDN(qname), qtype, 0)
 }
 
-func (r *Resolver) resolve(ctx context.Context, qname, qtype string, depth int) (RRs, error) {
+// newResolution returns a context for a top-level resolution by r, with
+// the timeout of r, its deadline by the Clock of r, a query budget and
+// the delegations found, after a priming query if one is due.
+func (r *Resolver) newResolution(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	ctx = withBudget(ctx, r.maxQueries, r.maxSubres)
+	ctx = r.withDeadline(ctx)
+	r.prime(ctx)
+	return withDelegations(ctx), cancel
+}
+
+func (r *Resolver) resolve(ctx context.Context, qname, qtype string, depth int) (rrs RRs, err error) {
 	if depth++; depth > MaxRecursion {
-		logMaxRecursion(qname, qtype, depth)
+		r.emit(ctx, MaxRecursionEvent{QName: qname, QType: qtype, Depth: depth})
 		return nil, ErrMaxRecursion
 	}
-	rrs, err := r.cacheGet(ctx, qname, qtype)
+	ctx, span := r.startSpan(ctx, "dnsr.resolve",
+		Attribute{AttrQName, qname}, Attribute{AttrQType, qtype}, Attribute{AttrDepth, depth})
+	defer func() {
+		span.SetAttributes(Attribute{AttrRRs, len(rrs)})
+		endSpan(span, err)
+	}()
+	if err := checkBudget(ctx); err != nil {
+		return nil, err
+	}
+	top := topLevel(ctx)
+	if rrs, ok, err := r.localGet(ctx, qname, qtype, depth); ok {
+		return rrs, err
+	}
+	rrs, err = r.cacheGet(ctx, qname, qtype)
+	hit := len(rrs) > 0 || err == NXDOMAIN
+	span.SetAttributes(Attribute{AttrCacheHit, hit})
+	if hit {
+		r.emit(ctx, CacheHitEvent{QName: qname, QType: qtype, Depth: depth, RRs: rrs, Err: err})
+	}
 	if err != nil {
 		return nil, err
 	}
 	if len(rrs) > 0 {
 		return rrs, nil
 	}
-	logResolveStart(qname, qtype, depth)
-	start := time.Now()
-	rrs, err = r.iterateParents(ctx, qname, qtype, depth)
-	logResolveEnd(qname, qtype, rrs, depth, start, err)
+	r.emit(ctx, CacheMissEvent{QName: qname, QType: qtype, Depth: depth})
+	r.emit(ctx, ResolveStartEvent{QName: qname, QType: qtype, Depth: depth, TopLevel: top})
+	start := r.clock.Now()
+	if z := r.zoneFor(qname); z != nil && z.forward {
+		rrs, err = r.forward(ctx, z, qname, qtype, depth)
+	} else {
+		rrs, err = r.iterateParents(ctx, qname, qtype, depth)
+	}
+	r.emit(ctx, ResolveEndEvent{QName: qname, QType: qtype, Depth: depth, TopLevel: top, RRs: rrs, Err: err, Duration: r.clock.Now().Sub(start)})
 	return rrs, err
 }
 
+type topLevelKey struct{}
+
+// withTopLevel returns a context for a top-level resolution. The first
+// name resolved in the context is the top-level resolution; names resolved
+// for it, such as glueless name servers, are not, even at depth 1.
+func withTopLevel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, topLevelKey{}, new(int32))
+}
+
+// topLevel returns true for the first call in a context for a top-level resolution.
+func topLevel(ctx context.Context) bool {
+	p, ok := ctx.Value(topLevelKey{}).(*int32)
+	return ok && atomic.CompareAndSwapInt32(p, 0, 1)
+}
+
 func (r *Resolver) iterateParents(ctx context.Context, qname, qtype string, depth int) (RRs, error) {
 	chanRRs := make(chan RRs, MaxNameservers)
 	chanErrs := make(chan error, MaxNameservers)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	for pname, ok := qname, true; ok; pname, ok = parent(pname) {
+		stub := r.zones[pname]
+		if stub != nil && stub.forward {
+			stub = nil
+		}
+
 		// If we’re looking for [foo.com,NS], then move on to the parent ([com,NS])
-		if pname == qname && qtype == "NS" {
+		if pname == qname && qtype == "NS" && stub == nil {
 			continue
 		}
 
@@ -137,42 +245,55 @@ func (r *Resolver) iterateParents(ctx context.Context, qname, qtype string, dept
 			return nil, nil
 		}
 
-		// Get nameservers
-		nrrs, err := r.resolve(ctx, pname, "NS", depth)
-		if err == NXDOMAIN || err == ErrTimeout || err == context.DeadlineExceeded {
-			return nil, err
-		}
-		if err != nil {
-			continue
+		// Answer TLD queries from the local root zone, if any
+		if pname == "." && r.rootZone != nil {
+			atomic.AddUint64(&r.stats.RootZoneAnswers, 1)
+			rmsg := r.rootZone.answer(qname, qtype)
+			r.emit(ctx, RootZoneEvent{Response: rmsg, Depth: depth})
+			return r.handleResponse(ctx, ".", pname, qname, qtype, rmsg, depth)
 		}
 
-		// Check cache for specific queries
-		if len(nrrs) > 0 && qtype != "" {
-			rrs, err := r.cacheGet(ctx, qname, qtype)
-			if err != nil {
+		// Get nameservers, from the stub zone configuration if any
+		var nrrs RRs
+		var nss []nameserver
+		var err error
+		if stub != nil {
+			nss = stub.nameservers()
+		} else {
+			nrrs, err = r.resolve(ctx, pname, "NS", depth)
+			if err == NXDOMAIN || err == ErrTimeout || budgetExceeded(err) || err == context.DeadlineExceeded {
 				return nil, err
 			}
-			if len(rrs) > 0 {
-				return rrs, nil
+			if err != nil {
+				continue
+			}
+
+			// Check cache for specific queries
+			if len(nrrs) > 0 && qtype != "" {
+				rrs, err := r.cacheGet(ctx, qname, qtype)
+				if err != nil {
+					return nil, err
+				}
+				if len(rrs) > 0 {
+					return rrs, nil
+				}
 			}
+
+			// Skip lame servers
+			nss = r.withoutLame(pname, r.nameservers(ctx, pname, nrrs))
 		}
 
 		// Query all nameservers in parallel
 		count := 0
-		for i := 0; i < len(nrrs) && count < MaxNameservers; i++ {
-			nrr := nrrs[i]
-			if nrr.Type != "NS" {
-				continue
-			}
-
-			go func(host string) {
-				rrs, err := r.exchange(ctx, host, qname, qtype, depth)
+		for i := 0; i < len(nss) && count < MaxNameservers; i++ {
+			go func(ns nameserver) {
+				rrs, err := r.exchange(ctx, ns, pname, qname, qtype, depth)
 				if err != nil {
 					chanErrs <- err
 				} else {
 					chanRRs <- rrs
 				}
-			}(nrr.Value)
+			}(nss[i])
 
 			count++
 		}
@@ -191,15 +312,16 @@ func (r *Resolver) iterateParents(ctx context.Context, qname, qtype string, dept
 				cancel() // stop any other work here before recursing
 				return r.resolveCNAMEs(ctx, qname, qtype, rrs, depth)
 			case err = <-chanErrs:
-				if err == NXDOMAIN {
+				if err == NXDOMAIN || budgetExceeded(err) {
 					return nil, err
 				}
 			}
 
 		}
 
-		// NS queries naturally recurse, so stop further iteration
-		if qtype == "NS" {
+		// NS queries naturally recurse, so stop further iteration.
+		// Never iterate above a stub zone.
+		if qtype == "NS" || stub != nil {
 			return nil, err
 		}
 	}
@@ -207,85 +329,165 @@ func (r *Resolver) iterateParents(ctx context.Context, qname, qtype string, dept
 	return nil, ErrNoResponse
 }
 
-func (r *Resolver) exchange(ctx context.Context, host, qname, qtype string, depth int) (RRs, error) {
-	dtype := dns.StringToType[qtype]
-	if dtype == 0 {
-		dtype = dns.TypeA
-	}
-	qmsg := &dns.Msg{}
-	qmsg.SetQuestion(qname, dtype)
+func (r *Resolver) exchange(ctx context.Context, ns nameserver, zone, qname, qtype string, depth int) (RRs, error) {
+	qmsg := r.newQuery(qname, qtype)
 	qmsg.MsgHdr.RecursionDesired = false
 
-	// Find each A record for the DNS server
-	count := 0
-	arrs, err := r.resolve(ctx, host, "A", depth)
-	if err != nil {
-		return nil, err
-	}
-	for _, arr := range arrs {
-		if arr.Type != "A" { // FIXME: support AAAA records?
-			continue
+	host, addrs := ns.host, ns.addrs
+	if len(addrs) == 0 {
+		// Try out-of-bailiwick glue as hints, if any
+		if len(ns.hints) > 0 {
+			rrs, err := r.exchangeAddrs(ctx, host, ns.hints, zone, qname, qtype, qmsg, depth)
+			if err != ErrNoARecords && err != ErrMaxIPs {
+				return rrs, err
+			}
 		}
 
+		// Resolve glueless name servers separately
+		var err error
+		addrs, err = r.resolveGlueless(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r.exchangeAddrs(ctx, host, addrs, zone, qname, qtype, qmsg, depth)
+}
+
+// exchangeAddrs sends qmsg to the IP addresses of name server host in
+// turn, and handles the first response. It returns ErrNoARecords or
+// ErrMaxIPs if no address responded.
+func (r *Resolver) exchangeAddrs(ctx context.Context, host string, addrs []string, zone, qname, qtype string, qmsg *dns.Msg, depth int) (RRs, error) {
+	count := 0
+	for _, addr := range addrs {
 		// Never query more than MaxIPs for any nameserver
 		if count++; count > MaxIPs {
 			return nil, ErrMaxIPs
 		}
 
-		// Synchronously query this DNS server
-		start := time.Now()
-		timeout := r.timeout // belt and suspenders, since ctx has a deadline from ResolveErr
-		if dl, ok := ctx.Deadline(); ok {
-			if start.After(dl.Add(-TypicalResponseTime)) { // bail if we can't finish in time (start is too close to deadline)
-				return nil, ErrTimeout
-			}
-			timeout = dl.Sub(start)
+		rmsg, err := r.query(ctx, zone, host, addr, qmsg, depth)
+		switch {
+		case err == nil:
+			// Return after first successful network request
+			return r.handleResponse(ctx, host, zone, qname, qtype, rmsg, depth)
+		case err == ErrTimeout || budgetExceeded(err) || err == ctx.Err():
+			return nil, err
 		}
+	}
+
+	return nil, ErrNoARecords
+}
+
+// newQuery returns a query message for qname and qtype,
+// with 0x20 encoding if enabled.
+func (r *Resolver) newQuery(qname, qtype string) *dns.Msg {
+	dtype := dns.StringToType[qtype]
+	if dtype == 0 {
+		dtype = dns.TypeA
+	}
+	qmsg := &dns.Msg{}
+	if r.randomizeCase {
+		qmsg.SetQuestion(randomizeCase(qname), dtype)
+	} else {
+		qmsg.SetQuestion(qname, dtype)
+	}
+	return qmsg
+}
 
-		client := &dns.Client{Timeout: timeout} // client must finish within remaining timeout
-		rmsg, dur, err := client.Exchange(qmsg, arr.Value+":53")
-		select {
-		case <-ctx.Done(): // Finished too late
-			logCancellation(host, qmsg, rmsg, depth, dur, timeout)
-			return nil, ctx.Err()
-		default:
-			logExchange(host, qmsg, rmsg, depth, dur, timeout, err) // Log hostname instead of IP
+// query synchronously sends qmsg to the name server host for zone at addr
+// and returns a response that matches qmsg.
+func (r *Resolver) query(ctx context.Context, zone, host, addr string, qmsg *dns.Msg, depth int) (*dns.Msg, error) {
+	return r.queryWith(ctx, r.exchanger, zone, host, hostPort(addr), qmsg, depth)
+}
+
+// queryWith is like query, using exchanger x. The format of addr depends on x.
+func (r *Resolver) queryWith(ctx context.Context, x exchanger, zone, host, addr string, qmsg *dns.Msg, depth int) (rmsg *dns.Msg, err error) {
+	ctx, span := r.startSpan(ctx, "dnsr.exchange",
+		Attribute{AttrQName, qmsg.Question[0].Name}, Attribute{AttrQType, dns.TypeToString[qmsg.Question[0].Qtype]},
+		Attribute{AttrZone, zone}, Attribute{AttrServer, host}, Attribute{AttrAddr, addr})
+	defer func() {
+		if rmsg != nil {
+			span.SetAttributes(Attribute{AttrRcode, dns.RcodeToString[rmsg.Rcode]})
 		}
-		if err != nil {
-			continue
+		endSpan(span, err)
+	}()
+	if err := r.spendQuery(ctx); err != nil {
+		return nil, err
+	}
+	start := r.clock.Now()
+	timeout := r.timeout // belt and suspenders, since ctx has a deadline from ResolveErr
+	if dl, ok := r.deadline(ctx); ok {
+		if start.After(dl.Add(-TypicalResponseTime)) { // bail if we can't finish in time (start is too close to deadline)
+			return nil, ErrTimeout
 		}
+		timeout = dl.Sub(start)
+	}
 
-		// FIXME: cache NXDOMAIN responses responsibly
-		if rmsg.Rcode == dns.RcodeNameError {
-			var hasSOA bool
-			if qtype == "NS" {
-				for _, drr := range rmsg.Ns {
-					rr, ok := convertRR(drr, r.expire)
-					if !ok {
-						continue
-					}
-					if rr.Type == "SOA" {
-						hasSOA = true
-						break
-					}
+	proto := protocolOf(x)
+	if r.replay != nil {
+		x = r.replay.zone(zone)
+	}
+	r.emit(ctx, ExchangeSentEvent{Zone: zone, Host: host, Addr: addr, Protocol: proto, Query: qmsg, Depth: depth, Timeout: timeout})
+	rmsg, dur, err := x.exchange(ctx, qmsg, addr, timeout) // must finish within remaining timeout
+	select {
+	case <-ctx.Done(): // Finished too late
+		r.emit(ctx, ExchangeCancelledEvent{Zone: zone, Host: host, Addr: addr, Protocol: proto, Query: qmsg, Response: rmsg, Depth: depth, Duration: dur, Timeout: timeout})
+		return nil, ctx.Err()
+	default:
+		r.emit(ctx, ExchangeReceivedEvent{Zone: zone, Host: host, Addr: addr, Protocol: proto, Query: qmsg, Response: rmsg, Depth: depth, Duration: dur, Timeout: timeout, Err: err})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject responses that do not answer the question asked
+	if err = checkResponse(qmsg, rmsg, r.randomizeCase); err != nil {
+		atomic.AddUint64(&r.stats.Mismatches, 1)
+		r.emit(ctx, ResponseRejectedEvent{Host: host, Query: qmsg, Response: rmsg, Depth: depth, Err: err})
+		return nil, err
+	}
+	return rmsg, nil
+}
+
+// handleResponse handles a response from a name server host for zone,
+// caching and returning the records for qname.
+func (r *Resolver) handleResponse(ctx context.Context, host, zone, qname, qtype string, rmsg *dns.Msg, depth int) (RRs, error) {
+	// FIXME: cache NXDOMAIN responses responsibly
+	if rmsg.Rcode == dns.RcodeNameError {
+		var hasSOA bool
+		if qtype == "NS" {
+			for _, drr := range rmsg.Ns {
+				rr, ok := r.convertRR(drr)
+				if !ok {
+					continue
+				}
+				if rr.Type == "SOA" {
+					hasSOA = true
+					break
 				}
 			}
-			if !hasSOA {
-				r.cache.addNX(qname)
-				return nil, NXDOMAIN
-			}
-		} else if rmsg.Rcode != dns.RcodeSuccess {
-			return nil, errors.New(dns.RcodeToString[rmsg.Rcode])
 		}
+		if !hasSOA {
+			r.cache.addNX(qname)
+			return nil, NXDOMAIN
+		}
+	} else if rmsg.Rcode != dns.RcodeSuccess {
+		if rmsg.Rcode == dns.RcodeRefused || rmsg.Rcode == dns.RcodeServerFailure {
+			r.markLame(ctx, zone, host, dns.RcodeToString[rmsg.Rcode], depth)
+		}
+		return nil, errors.New(dns.RcodeToString[rmsg.Rcode])
+	}
 
-		// Cache records returned
-		rrs := r.saveDNSRR(host, qname, append(append(rmsg.Answer, rmsg.Ns...), rmsg.Extra...))
-
-		// Return after first successful network request
-		return rrs, nil
+	// Reject responses from lame name servers
+	if reason := lameReason(rmsg, zone, qname); reason != "" {
+		if reason == lameInvalidReferral {
+			atomic.AddUint64(&r.stats.InvalidReferrals, 1)
+		}
+		r.markLame(ctx, zone, host, reason, depth)
+		return nil, ErrLame
 	}
 
-	return nil, ErrNoARecords
+	// Cache records returned
+	return r.saveDNSRR(ctx, host, zone, qname, rmsg, depth), nil
 }
 
 func (r *Resolver) resolveCNAMEs(ctx context.Context, qname, qtype string, crrs RRs, depth int) (RRs, error) {
@@ -295,7 +497,7 @@ func (r *Resolver) resolveCNAMEs(ctx context.Context, qname, qtype string, crrs
 		if crr.Type != "CNAME" || crr.Name != qname {
 			continue
 		}
-		logCNAME(crr.String(), depth)
+		r.emit(ctx, CNAMEFollowedEvent{CNAME: crr, Depth: depth})
 		crrs, _ := r.resolve(ctx, crr.Value, qtype, depth)
 		for _, rr := range crrs {
 			r.cache.add(qname, rr)
@@ -305,28 +507,67 @@ func (r *Resolver) resolveCNAMEs(ctx context.Context, qname, qtype string, crrs
 	return rrs, nil
 }
 
-// saveDNSRR saves 1 or more DNS records to the resolver cache.
-func (r *Resolver) saveDNSRR(host, qname string, drrs []dns.RR) RRs {
+// saveDNSRR saves 1 or more DNS records from a response by a name server
+// for zone to the resolver cache. Records outside of zone are rejected,
+// as are referrals that do not point to a zone cut below zone.
+// Out-of-bailiwick glue is not cached; it is kept in the delegation only
+// as address hints, tried before the name server is resolved as glueless.
+func (r *Resolver) saveDNSRR(ctx context.Context, host, zone, qname string, rmsg *dns.Msg, depth int) RRs {
 	var rrs RRs
-	cl := dns.CountLabel(qname)
-	for _, drr := range drrs {
-		rr, ok := convertRR(drr, r.expire)
-		if !ok {
-			continue
-		}
-		if dns.CountLabel(rr.Name) < cl && dns.CompareDomainName(qname, rr.Name) < 2 {
-			// fmt.Fprintf(os.Stderr, "Warning: potential poisoning from %s: %s -> %s\n", host, qname, drr.String())
-			continue
-		}
-		r.cache.add(rr.Name, rr)
-		if rr.Name != qname {
-			continue
+	referral := isReferral(rmsg)
+	d := parseReferral(rmsg, zone, qname)
+	if d != nil {
+		r.emit(ctx, d.event(host, depth))
+		addDelegation(ctx, d)
+	}
+	sections := [][]dns.RR{rmsg.Answer, rmsg.Ns, rmsg.Extra}
+	for i, drrs := range sections {
+		for _, drr := range drrs {
+			if drr.Header().Rrtype == dns.TypeOPT {
+				continue
+			}
+			rr, ok := r.convertRR(drr)
+			if !ok {
+				continue
+			}
+			if rr.Class != "" {
+				r.emit(ctx, RecordRejectedEvent{Host: host, Zone: zone, Record: drr, Depth: depth, Reason: "wrong class"})
+				continue
+			}
+			if !inBailiwick(rr.Name, zone) {
+				atomic.AddUint64(&r.stats.OutOfBailiwick, 1)
+				r.emit(ctx, RecordRejectedEvent{Host: host, Zone: zone, Record: drr, Depth: depth, Reason: "out of bailiwick"})
+				continue
+			}
+			if referral && i == 1 && rr.Type == "NS" && (d == nil || rr.Name != d.zone) {
+				atomic.AddUint64(&r.stats.InvalidReferrals, 1)
+				r.emit(ctx, RecordRejectedEvent{Host: host, Zone: zone, Record: drr, Depth: depth, Reason: "invalid referral"})
+				continue
+			}
+			r.cache.add(rr.Name, rr)
+			if rr.Name != qname {
+				continue
+			}
+			rrs = append(rrs, rr)
 		}
-		rrs = append(rrs, rr)
 	}
 	return rrs
 }
 
+// isReferral returns true if rmsg is a non-authoritative response
+// with no answers and NS records in the authority section.
+func isReferral(rmsg *dns.Msg) bool {
+	if rmsg.Authoritative || len(rmsg.Answer) > 0 {
+		return false
+	}
+	for _, drr := range rmsg.Ns {
+		if drr.Header().Rrtype == dns.TypeNS {
+			return true
+		}
+	}
+	return false
+}
+
 // cacheGet returns a randomly ordered slice of DNS records.
 func (r *Resolver) cacheGet(ctx context.Context, qname, qtype string) (RRs, error) {
 	select {
@@ -336,7 +577,7 @@ func (r *Resolver) cacheGet(ctx context.Context, qname, qtype string) (RRs, erro
 	}
 	any := r.cache.get(qname)
 	if any == nil {
-		any = rootCache.get(qname)
+		any = r.roots().get(qname)
 	}
 	if any == nil {
 		return nil, nil
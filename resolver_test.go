@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/nbio/st"
 )
 
@@ -250,3 +251,42 @@ func all(rrs RRs, f func(RR) bool) (out bool) {
 	}
 	return true
 }
+
+func TestBailiwick(t *testing.T) {
+	n := newTestNet(t)
+	poison := func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rr, _ := dns.NewRR("www.google.com. 3600 IN A 203.0.113.66")
+		rmsg.Extra = append(rmsg.Extra, rr)
+		return rmsg
+	}
+	n.server("192.0.2.53").rewrite = poison
+	r := newTestResolver(n)
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "192.0.2.2" }), 1)
+	st.Expect(t, r.cache.get("www.google.com."), RRs(nil))
+	st.Expect(t, r.Stats().OutOfBailiwick > 0, true)
+}
+
+func TestInvalidReferral(t *testing.T) {
+	n := newTestNet(t)
+	upward := func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		if qmsg.Question[0].Name != "evil.example.com." {
+			return rmsg
+		}
+		rr, _ := dns.NewRR("example.com. 3600 IN NS ns.example.net.")
+		rmsg.Authoritative = false
+		rmsg.Rcode = dns.RcodeSuccess
+		rmsg.Answer = nil
+		rmsg.Ns = []dns.RR{rr}
+		return rmsg
+	}
+	n.server("192.0.2.53").rewrite = upward
+	r := newTestResolver(n)
+	r.ResolveErr("evil.example.com", "A")
+	st.Expect(t, r.Stats().InvalidReferrals > 0, true)
+	st.Expect(t, r.Stats().LameDelegations > 0, true)
+	for _, rr := range r.cache.get("example.com.") {
+		st.Reject(t, rr.Value, "ns.example.net.")
+	}
+}
@@ -1,7 +1,13 @@
 package dnsr
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -18,9 +24,99 @@ func init() {
 		if t.Error != nil {
 			continue
 		}
-		rr, ok := convertRR(t.RR, false)
+		rr, ok := convertRR(t.RR, time.Time{})
 		if ok {
 			rootCache.add(rr.Name, rr)
 		}
 	}
 }
+
+// RootHints is a set of root name servers and their IP addresses,
+// used to find the root name servers. By default, a Resolver uses
+// the root hints compiled into this package.
+type RootHints struct {
+	cache *cache
+}
+
+// RootServer is a root name server host name and its IP addresses.
+type RootServer struct {
+	Name  string
+	Addrs []string
+}
+
+// errNoRootServers is returned for root hints with no usable root name servers.
+var errNoRootServers = errors.New("root hints: no root name servers with addresses")
+
+// ReadRootHints reads root hints in the format of the named.root
+// file published by InterNIC, which is a zone file containing NS
+// records for the root and A or AAAA records for each name server.
+func ReadRootHints(r io.Reader) (*RootHints, error) {
+	c := newCache(MinCacheCapacity, false)
+	for t := range dns.ParseZone(r, ".", "") {
+		if t.Error != nil {
+			return nil, t.Error
+		}
+		rr, ok := convertRR(t.RR, time.Time{})
+		if !ok {
+			continue
+		}
+		switch {
+		case rr.Type == "NS" && rr.Name == ".":
+		case rr.Type == "A" || rr.Type == "AAAA":
+		default:
+			continue
+		}
+		c.add(rr.Name, rr)
+	}
+	return newRootHints(c)
+}
+
+// NewRootHints returns root hints for a list of root name servers.
+func NewRootHints(servers ...RootServer) (*RootHints, error) {
+	c := newCache(MinCacheCapacity, false)
+	for _, s := range servers {
+		name := toLowerFQDN(s.Name)
+		c.add(".", RR{Name: ".", Type: "NS", Value: name})
+		for _, addr := range s.Addrs {
+			ip := net.ParseIP(addr)
+			switch {
+			case ip == nil:
+				return nil, fmt.Errorf("root hints: invalid address for %s: %q", name, addr)
+			case ip.To4() != nil:
+				c.add(name, RR{Name: name, Type: "A", Value: ip.String()})
+			default:
+				c.add(name, RR{Name: name, Type: "AAAA", Value: ip.String()})
+			}
+		}
+	}
+	return newRootHints(c)
+}
+
+// newRootHints validates that c has at least one root name server with an address.
+func newRootHints(c *cache) (*RootHints, error) {
+	for _, nrr := range c.get(".") {
+		if len(c.get(nrr.Value)) > 0 {
+			return &RootHints{c}, nil
+		}
+	}
+	return nil, errNoRootServers
+}
+
+// Servers returns the root name servers in h, sorted by name,
+// with IPv4 addresses before IPv6 addresses.
+func (h *RootHints) Servers() []RootServer {
+	var servers []RootServer
+	for _, nrr := range h.cache.get(".") {
+		s := RootServer{Name: nrr.Value}
+		for _, qtype := range []string{"A", "AAAA"} {
+			for _, rr := range h.cache.get(nrr.Value) {
+				if rr.Type == qtype {
+					s.Addrs = append(s.Addrs, rr.Value)
+				}
+			}
+		}
+		servers = append(servers, s)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
@@ -0,0 +1,67 @@
+package dnsr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestReadRootHints(t *testing.T) {
+	hints, err := ReadRootHints(strings.NewReader(root))
+	st.Expect(t, err, nil)
+	servers := hints.Servers()
+	st.Expect(t, len(servers), 13)
+	for _, s := range servers {
+		st.Expect(t, strings.HasSuffix(s.Name, ".root-servers.net."), true)
+		st.Expect(t, len(s.Addrs), 2)
+	}
+
+	_, err = ReadRootHints(strings.NewReader(". 3600000 NS a.root-servers.net.\n"))
+	st.Expect(t, err, errNoRootServers)
+
+	_, err = ReadRootHints(strings.NewReader("a.root-servers.net. 3600000 A not-an-ip\n"))
+	st.Reject(t, err, nil)
+}
+
+func TestNewRootHints(t *testing.T) {
+	hints, err := NewRootHints(RootServer{"Root.Lab", []string{"10.255.0.1", "2001:db8::1"}})
+	st.Expect(t, err, nil)
+	st.Expect(t, hints.Servers(), []RootServer{{"root.lab.", []string{"10.255.0.1", "2001:db8::1"}}})
+
+	_, err = NewRootHints(RootServer{"root.lab.", []string{"not-an-ip"}})
+	st.Reject(t, err, nil)
+	_, err = NewRootHints(RootServer{"root.lab.", nil})
+	st.Expect(t, err, errNoRootServers)
+	_, err = NewRootHints()
+	st.Expect(t, err, errNoRootServers)
+}
+
+func TestWithRootHints(t *testing.T) {
+	n := newTestNet(t)
+	labRoot := n.add(t, `
+.                   IN SOA root.lab. hostmaster.lab. 1 1800 900 604800 86400
+.                   IN NS  root.lab.
+root.lab.           IN A   10.255.0.1
+test.               IN NS  ns.test.
+ns.test.            IN A   10.255.0.2
+`, "10.255.0.1")
+	n.add(t, `
+test.               IN SOA ns.test. hostmaster.test. 1 1800 900 604800 86400
+test.               IN NS  ns.test.
+ns.test.            IN A   10.255.0.2
+www.test.           IN A   10.255.1.1
+`, "10.255.0.2")
+	hints, err := NewRootHints(RootServer{"root.lab.", []string{"10.255.0.1"}})
+	st.Assert(t, err, nil)
+	r := newTestResolver(n, WithRootHints(hints))
+	rrs, err := r.ResolveErr("www.test", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "10.255.1.1" }), 1)
+	st.Expect(t, labRoot.count("test."), 1)
+
+	// The default root hints are unaffected
+	r = newTestResolver(n)
+	rrs, _ = r.ResolveErr("www.test", "A")
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 0)
+}
@@ -0,0 +1,148 @@
+package dnsr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// RootZone is a local copy of the root zone (RFC 8806).
+// A Resolver with a RootZone answers TLD delegations and nonexistent
+// TLDs from the local copy, without querying the root name servers.
+// Safe for concurrent usage.
+type RootZone struct {
+	m      sync.RWMutex
+	serial uint32
+	soa    *dns.SOA
+	rrs    map[string][]dns.RR // by lower-case owner name
+}
+
+// errNoRootSOA is returned for a root zone without a SOA record.
+var errNoRootSOA = errors.New("root zone: no SOA record for .")
+
+// ReadRootZone reads a copy of the root zone in zone file format,
+// for example from https://www.internic.net/domain/root.zone.
+func ReadRootZone(r io.Reader) (*RootZone, error) {
+	z := &RootZone{}
+	soa, rrs, err := parseRootZone(r)
+	if err != nil {
+		return nil, err
+	}
+	z.soa, z.serial, z.rrs = soa, soa.Serial, rrs
+	return z, nil
+}
+
+// Reload replaces the contents of z with the root zone read from r.
+// If the serial number of the new zone is older than the current serial
+// number, z is unchanged and an error is returned. If the serial number
+// is the same, z is unchanged.
+func (z *RootZone) Reload(r io.Reader) error {
+	soa, rrs, err := parseRootZone(r)
+	if err != nil {
+		return err
+	}
+	z.m.Lock()
+	defer z.m.Unlock()
+	if soa.Serial == z.serial {
+		return nil
+	}
+	if !serialNewer(soa.Serial, z.serial) {
+		return fmt.Errorf("root zone: serial %d is older than %d", soa.Serial, z.serial)
+	}
+	z.soa, z.serial, z.rrs = soa, soa.Serial, rrs
+	return nil
+}
+
+// Serial returns the serial number of z.
+func (z *RootZone) Serial() uint32 {
+	z.m.RLock()
+	defer z.m.RUnlock()
+	return z.serial
+}
+
+// parseRootZone parses a root zone from r, returning its SOA and records by owner name.
+func parseRootZone(r io.Reader) (*dns.SOA, map[string][]dns.RR, error) {
+	var soa *dns.SOA
+	rrs := make(map[string][]dns.RR)
+	for t := range dns.ParseZone(r, ".", "") {
+		if t.Error != nil {
+			return nil, nil, t.Error
+		}
+		name := toLowerFQDN(t.RR.Header().Name)
+		if s, ok := t.RR.(*dns.SOA); ok && name == "." {
+			soa = s
+		}
+		rrs[name] = append(rrs[name], t.RR)
+	}
+	if soa == nil {
+		return nil, nil, errNoRootSOA
+	}
+	return soa, rrs, nil
+}
+
+// serialNewer returns true if serial a is newer than b,
+// using serial number arithmetic (RFC 1982).
+func serialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// answer returns a response to a query for qname and qtype,
+// as the root name servers would: a referral for names in a TLD,
+// an authoritative answer for the root itself, or NXDOMAIN.
+func (z *RootZone) answer(qname, qtype string) *dns.Msg {
+	z.m.RLock()
+	defer z.m.RUnlock()
+	dtype := dns.StringToType[qtype]
+	if dtype == 0 {
+		dtype = dns.TypeA
+	}
+	rmsg := &dns.Msg{}
+	rmsg.SetQuestion(qname, dtype)
+	rmsg.Response = true
+
+	labels := dns.SplitDomainName(qname)
+	if len(labels) == 0 {
+		rmsg.Authoritative = true
+		for _, rr := range z.rrs["."] {
+			if rr.Header().Rrtype == dtype {
+				rmsg.Answer = append(rmsg.Answer, rr)
+			}
+		}
+		if len(rmsg.Answer) == 0 {
+			rmsg.Ns = append(rmsg.Ns, z.soa)
+		}
+		return rmsg
+	}
+
+	tld := toLowerFQDN(labels[len(labels)-1])
+	for _, rr := range z.rrs[tld] {
+		switch rr.Header().Rrtype {
+		case dns.TypeNS:
+			rmsg.Ns = append(rmsg.Ns, rr)
+			for _, grr := range z.rrs[toLowerFQDN(rr.(*dns.NS).Ns)] {
+				if t := grr.Header().Rrtype; t == dns.TypeA || t == dns.TypeAAAA {
+					rmsg.Extra = append(rmsg.Extra, grr)
+				}
+			}
+		case dns.TypeDS:
+			if qname == tld && dtype == dns.TypeDS {
+				rmsg.Answer = append(rmsg.Answer, rr)
+			}
+		}
+	}
+	if len(rmsg.Answer) > 0 {
+		rmsg.Authoritative = true
+		rmsg.Ns, rmsg.Extra = nil, nil
+		return rmsg
+	}
+	if len(rmsg.Ns) > 0 {
+		return rmsg
+	}
+	rmsg.Authoritative = true
+	rmsg.Rcode = dns.RcodeNameError
+	rmsg.Ns = append(rmsg.Ns, z.soa)
+	return rmsg
+}
@@ -0,0 +1,86 @@
+package dnsr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+const testRootZone = `
+.                   86400  IN SOA a.root-servers.net. nstld.verisign-grs.com. %s 1800 900 604800 86400
+.                   518400 IN NS  a.root-servers.net.
+com.                172800 IN NS  a.gtld-servers.net.
+com.                172800 IN NS  b.gtld-servers.net.
+com.                86400  IN DS  30909 8 2 E2D3C916F6DEEAC73294E8268FB5885044A833FC5459588F4A9184CFC41A5766
+a.gtld-servers.net. 172800 IN A   192.5.6.30
+b.gtld-servers.net. 172800 IN A   192.33.14.30
+`
+
+func readTestRootZone(t *testing.T, serial string) *RootZone {
+	z, err := ReadRootZone(strings.NewReader(strings.Replace(testRootZone, "%s", serial, 1)))
+	st.Assert(t, err, nil)
+	return z
+}
+
+func TestRootZoneReload(t *testing.T) {
+	z := readTestRootZone(t, "2020022000")
+	st.Expect(t, z.Serial(), uint32(2020022000))
+	st.Expect(t, z.Reload(strings.NewReader(strings.Replace(testRootZone, "%s", "2020022001", 1))), nil)
+	st.Expect(t, z.Serial(), uint32(2020022001))
+	st.Expect(t, z.Reload(strings.NewReader(strings.Replace(testRootZone, "%s", "2020022001", 1))), nil)
+	st.Reject(t, z.Reload(strings.NewReader(strings.Replace(testRootZone, "%s", "2020021900", 1))), nil)
+	st.Expect(t, z.Serial(), uint32(2020022001))
+	st.Expect(t, z.Reload(strings.NewReader("com. 172800 IN NS a.gtld-servers.net.\n")), errNoRootSOA)
+
+	_, err := ReadRootZone(strings.NewReader("com. 172800 IN NS a.gtld-servers.net.\n"))
+	st.Expect(t, err, errNoRootSOA)
+}
+
+func TestSerialNewer(t *testing.T) {
+	st.Expect(t, serialNewer(2, 1), true)
+	st.Expect(t, serialNewer(1, 2), false)
+	st.Expect(t, serialNewer(1, 1), false)
+	st.Expect(t, serialNewer(0, 0xffffffff), true)
+}
+
+func TestRootZoneAnswer(t *testing.T) {
+	z := readTestRootZone(t, "1")
+
+	rmsg := z.answer("example.com.", "NS")
+	st.Expect(t, rmsg.Rcode, dns.RcodeSuccess)
+	st.Expect(t, rmsg.Authoritative, false)
+	st.Expect(t, len(rmsg.Ns), 2)
+	st.Expect(t, len(rmsg.Extra), 2)
+	st.Assert(t, parseReferral(rmsg, ".", "example.com.") != nil, true)
+
+	rmsg = z.answer("com.", "DS")
+	st.Expect(t, rmsg.Authoritative, true)
+	st.Expect(t, len(rmsg.Answer), 1)
+
+	rmsg = z.answer(".", "NS")
+	st.Expect(t, rmsg.Authoritative, true)
+	st.Expect(t, len(rmsg.Answer), 1)
+
+	rmsg = z.answer("nope.", "NS")
+	st.Expect(t, rmsg.Rcode, dns.RcodeNameError)
+	st.Expect(t, rmsg.Authoritative, true)
+	st.Expect(t, len(rmsg.Ns), 1)
+}
+
+func TestWithRootZone(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	root.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		return nil
+	}
+	r := newTestResolver(n, WithRootZone(readTestRootZone(t, "1")))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+	_, err = r.ResolveErr("nope", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, len(root.queries), 0)
+	st.Expect(t, r.Stats().RootZoneAnswers > 0, true)
+}
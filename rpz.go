@@ -0,0 +1,401 @@
+package dnsr
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// PolicyTrigger is the kind of response policy zone rule that matched a query.
+type PolicyTrigger int
+
+const (
+	// TriggerQName matches the query name, or a CNAME target in the response.
+	TriggerQName PolicyTrigger = iota
+
+	// TriggerResponseIP matches an A or AAAA address in the response.
+	TriggerResponseIP
+
+	// TriggerNSDName matches the name of a name server for the query name.
+	TriggerNSDName
+)
+
+var triggerNames = [...]string{"QNAME", "RESPONSE-IP", "NSDNAME"}
+
+func (t PolicyTrigger) String() string {
+	if int(t) < len(triggerNames) {
+		return triggerNames[t]
+	}
+	return "TRIGGER" + strconv.Itoa(int(t))
+}
+
+// PolicyAction is the action of a response policy zone rule.
+type PolicyAction int
+
+const (
+	// ActionNXDOMAIN answers NXDOMAIN (CNAME .).
+	ActionNXDOMAIN PolicyAction = iota
+
+	// ActionNODATA answers with no records (CNAME *.).
+	ActionNODATA
+
+	// ActionPassthru answers normally, ignoring later rules (CNAME rpz-passthru.).
+	ActionPassthru
+
+	// ActionLocalData answers with the records of the rule, such as
+	// a CNAME record to rewrite the query name.
+	ActionLocalData
+)
+
+var actionNames = [...]string{"NXDOMAIN", "NODATA", "PASSTHRU", "LOCAL-DATA"}
+
+func (a PolicyAction) String() string {
+	if int(a) < len(actionNames) {
+		return actionNames[a]
+	}
+	return "ACTION" + strconv.Itoa(int(a))
+}
+
+// PolicyHit describes a query that matched a response policy zone rule.
+type PolicyHit struct {
+	Zone    string // policy zone
+	QName   string
+	QType   string
+	Trigger PolicyTrigger
+	Rule    string // matched name, CNAME target, IP prefix or name server
+	Action  PolicyAction
+}
+
+// PolicyZone is a response policy zone (RPZ), which blocks or rewrites
+// responses. Safe for concurrent usage.
+type PolicyZone struct {
+	zone string
+
+	m         sync.RWMutex
+	qnames    map[string]*policyRule
+	wildcards map[string]*policyRule // by parent of the wildcard name
+	nsdnames  map[string]*policyRule
+	nswilds   map[string]*policyRule
+	ips       []*policyRule
+}
+
+// policyRule is a rule in a PolicyZone.
+type policyRule struct {
+	trigger PolicyTrigger
+	name    string     // trigger name, or IP prefix
+	ipnet   *net.IPNet // for TriggerResponseIP
+	action  PolicyAction
+	data    []dns.RR // local data
+}
+
+// Special CNAME targets in response policy zones.
+const (
+	policyNODATA   = "*."
+	policyPassthru = "rpz-passthru."
+	policyIP       = "rpz-ip"
+	policyNSDName  = "rpz-nsdname"
+)
+
+// ReadPolicyZone reads a response policy zone named zone from r,
+// in zone file format. Relative names are relative to zone.
+// Rules for QNAME triggers are named after the query name, for example
+// bad.example.rpz.example. CNAME . for NXDOMAIN, or *.bad.example.rpz.example.
+// for all names below bad.example. Rules for response IP triggers are named
+// under rpz-ip, and rules for NSDNAME triggers under rpz-nsdname.
+// Unsupported triggers and actions are ignored.
+func ReadPolicyZone(r io.Reader, zone string) (*PolicyZone, error) {
+	z := &PolicyZone{zone: toLowerFQDN(zone)}
+	if err := z.Reload(r); err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// Reload replaces the rules in z with the rules read from r.
+// If r cannot be parsed, z is unchanged and an error is returned.
+func (z *PolicyZone) Reload(r io.Reader) error {
+	owners := make(map[string][]dns.RR)
+	var names []string
+	for t := range dns.ParseZone(r, z.zone, "") {
+		if t.Error != nil {
+			return t.Error
+		}
+		name := toLowerFQDN(t.RR.Header().Name)
+		if name == z.zone || !dns.IsSubDomain(z.zone, name) {
+			continue
+		}
+		if owners[name] == nil {
+			names = append(names, name)
+		}
+		owners[name] = append(owners[name], t.RR)
+	}
+
+	qnames := make(map[string]*policyRule)
+	wildcards := make(map[string]*policyRule)
+	nsdnames := make(map[string]*policyRule)
+	nswilds := make(map[string]*policyRule)
+	var ips []*policyRule
+	for _, owner := range names {
+		rule := newPolicyRule(owners[owner])
+		if rule == nil {
+			continue
+		}
+		name := strings.TrimSuffix(owner, z.zone)
+		switch {
+		case strings.HasSuffix(name, "."+policyIP+"."):
+			rule.trigger = TriggerResponseIP
+			rule.ipnet = parsePolicyIP(strings.TrimSuffix(name, "."+policyIP+"."))
+			if rule.ipnet == nil {
+				continue
+			}
+			rule.name = rule.ipnet.String()
+			ips = append(ips, rule)
+		case strings.HasSuffix(name, "."+policyNSDName+"."):
+			rule.trigger = TriggerNSDName
+			addPolicyName(nsdnames, nswilds, rule, strings.TrimSuffix(name, policyNSDName+"."))
+		default:
+			rule.trigger = TriggerQName
+			addPolicyName(qnames, wildcards, rule, name)
+		}
+	}
+
+	z.m.Lock()
+	defer z.m.Unlock()
+	z.qnames, z.wildcards, z.nsdnames, z.nswilds, z.ips = qnames, wildcards, nsdnames, nswilds, ips
+	return nil
+}
+
+// newPolicyRule returns a rule with the action specified by rrs,
+// or nil if the action is not supported.
+func newPolicyRule(rrs []dns.RR) *policyRule {
+	if c, ok := rrs[0].(*dns.CNAME); ok && len(rrs) == 1 {
+		switch strings.ToLower(c.Target) {
+		case ".":
+			return &policyRule{action: ActionNXDOMAIN}
+		case policyNODATA:
+			return &policyRule{action: ActionNODATA}
+		case policyPassthru:
+			return &policyRule{action: ActionPassthru}
+		}
+		if strings.HasPrefix(c.Target, "*.") || strings.HasPrefix(strings.ToLower(c.Target), "rpz-") {
+			return nil
+		}
+	}
+	return &policyRule{action: ActionLocalData, data: rrs}
+}
+
+// addPolicyName adds rule for name (with a trailing dot) to exact or wildcards.
+func addPolicyName(exact, wildcards map[string]*policyRule, rule *policyRule, name string) {
+	if strings.HasPrefix(name, "*.") {
+		rule.name = name[2:]
+		wildcards[rule.name] = rule
+		return
+	}
+	rule.name = name
+	exact[name] = rule
+}
+
+// parsePolicyIP parses the reversed IP prefix in the name of a response IP
+// rule, such as 32.1.2.0.192. for 192.0.2.1/32, or 128.1.zz.db8.2001.
+// for 2001:db8::1/128.
+func parsePolicyIP(name string) *net.IPNet {
+	labels := dns.SplitDomainName(name)
+	if len(labels) < 2 {
+		return nil
+	}
+	addr := make([]string, 0, len(labels)-1)
+	for i := len(labels) - 1; i > 0; i-- {
+		addr = append(addr, labels[i])
+	}
+	s := strings.Join(addr, ".")
+	if net.ParseIP(s).To4() == nil {
+		for i := range addr {
+			if addr[i] == "zz" {
+				addr[i] = "" // ::
+			}
+		}
+		s = strings.Join(addr, ":")
+		if strings.HasPrefix(s, ":") {
+			s = ":" + s
+		}
+		if strings.HasSuffix(s, ":") {
+			s += ":"
+		}
+	}
+	_, ipnet, err := net.ParseCIDR(s + "/" + labels[0])
+	if err != nil {
+		return nil
+	}
+	return ipnet
+}
+
+// matchName returns the rule for name in exact, or the rule
+// for the closest wildcard name above name.
+func matchName(exact, wildcards map[string]*policyRule, name string) *policyRule {
+	if rule := exact[name]; rule != nil {
+		return rule
+	}
+	for pname, ok := parent(name); ok; pname, ok = parent(pname) {
+		if rule := wildcards[pname]; rule != nil {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchQName returns the rule for qname, or nil.
+func (z *PolicyZone) matchQName(qname string) *policyRule {
+	z.m.RLock()
+	defer z.m.RUnlock()
+	return matchName(z.qnames, z.wildcards, qname)
+}
+
+// matchNSDName returns the rule for name server host, or nil.
+func (z *PolicyZone) matchNSDName(host string) *policyRule {
+	z.m.RLock()
+	defer z.m.RUnlock()
+	return matchName(z.nsdnames, z.nswilds, host)
+}
+
+// matchIP returns the rule with the longest prefix containing ip, or nil.
+func (z *PolicyZone) matchIP(ip net.IP) *policyRule {
+	z.m.RLock()
+	defer z.m.RUnlock()
+	var best *policyRule
+	bestLen := -1
+	for _, rule := range z.ips {
+		if !rule.ipnet.Contains(ip) {
+			continue
+		}
+		if n, _ := rule.ipnet.Mask.Size(); n > bestLen {
+			best, bestLen = rule, n
+		}
+	}
+	return best
+}
+
+// WithPolicyZones specifies response policy zones, applied in order
+// to the results of Resolve, ResolveErr and ResolveCtx. QNAME rules in
+// all zones are checked before resolution, so blocked names are never
+// queried. Response IP and NSDNAME rules are checked after resolution.
+func WithPolicyZones(zs ...*PolicyZone) Option {
+	return func(r *Resolver) {
+		r.policies = append(r.policies, zs...)
+	}
+}
+
+// WithPolicyHook specifies a function called for each query that
+// matches a response policy zone rule, for example for audit logging.
+// It may be called concurrently.
+func WithPolicyHook(f func(PolicyHit)) Option {
+	return func(r *Resolver) {
+		r.policyHook = f
+	}
+}
+
+// resolvePolicy resolves qname and qtype, applying response policy zones.
+func (r *Resolver) resolvePolicy(ctx context.Context, qname, qtype string) (RRs, error) {
+	for _, z := range r.policies {
+		if rule := z.matchQName(qname); rule != nil {
+			return r.applyPolicy(ctx, z, rule, qname, qtype, nil, nil)
+		}
+	}
+	rrs, err := r.resolve(ctx, qname, qtype, 0)
+	if err != nil && err != NXDOMAIN {
+		return rrs, err
+	}
+	for _, z := range r.policies {
+		if rule := r.matchResponse(z, qname, rrs); rule != nil {
+			return r.applyPolicy(ctx, z, rule, qname, qtype, rrs, err)
+		}
+	}
+	return rrs, err
+}
+
+// matchResponse returns the first rule in z that matches the response rrs
+// for qname: CNAME targets, then addresses, then name servers for qname.
+func (r *Resolver) matchResponse(z *PolicyZone, qname string, rrs RRs) *policyRule {
+	for _, rr := range rrs {
+		if rr.Type == "CNAME" {
+			if rule := z.matchQName(rr.Value); rule != nil {
+				return rule
+			}
+		}
+	}
+	for _, rr := range rrs {
+		if rr.Type == "A" || rr.Type == "AAAA" {
+			if ip := net.ParseIP(rr.Value); ip != nil {
+				if rule := z.matchIP(ip); rule != nil {
+					return rule
+				}
+			}
+		}
+	}
+	for pname, ok := qname, true; ok; pname, ok = parent(pname) {
+		var found bool
+		for _, rr := range r.cache.get(pname) {
+			if rr.Type != "NS" {
+				continue
+			}
+			found = true
+			if rule := z.matchNSDName(rr.Value); rule != nil {
+				return rule
+			}
+		}
+		if found {
+			break
+		}
+	}
+	return nil
+}
+
+// applyPolicy applies rule in z to a query for qname and qtype,
+// with the unmodified result rrs and err, if resolved.
+func (r *Resolver) applyPolicy(ctx context.Context, z *PolicyZone, rule *policyRule, qname, qtype string, rrs RRs, err error) (RRs, error) {
+	hit := PolicyHit{
+		Zone:    z.zone,
+		QName:   qname,
+		QType:   qtype,
+		Trigger: rule.trigger,
+		Rule:    rule.name,
+		Action:  rule.action,
+	}
+	r.emit(ctx, PolicyEvent{Hit: hit})
+	if r.policyHook != nil {
+		r.policyHook(hit)
+	}
+	switch rule.action {
+	case ActionNXDOMAIN:
+		return nil, NXDOMAIN
+	case ActionNODATA:
+		return emptyRRs, nil
+	case ActionPassthru:
+		if rrs == nil && err == nil {
+			return r.resolve(ctx, qname, qtype, 0)
+		}
+		return rrs, err
+	}
+	out := emptyRRs
+	for _, drr := range rule.data {
+		rr, ok := convertRR(drr, time.Time{})
+		if !ok {
+			continue
+		}
+		rr.Name = qname
+		switch {
+		case rr.Type == "CNAME" && qtype != "CNAME":
+			out = append(out, rr)
+			crrs, _ := r.resolve(ctx, rr.Value, qtype, 0)
+			out = append(out, crrs...)
+		case qtype == "" || rr.Type == qtype:
+			out = append(out, rr)
+		}
+	}
+	return out, nil
+}
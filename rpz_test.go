@@ -0,0 +1,130 @@
+package dnsr
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+const testPolicyZone = `
+$TTL 300
+@                          IN SOA  localhost. hostmaster.localhost. 1 3600 600 86400 60
+@                          IN NS   localhost.
+blocked.example.com        IN CNAME .
+nodata.example.com         IN CNAME *.
+*.wild.test                IN CNAME .
+ok.wild.test               IN CNAME rpz-passthru.
+rewrite.test               IN CNAME www.example.com.
+local.test                 IN A    192.0.2.100
+local.test                 IN TXT  "local data"
+24.0.2.0.192.rpz-ip        IN CNAME .
+32.2.2.0.192.rpz-ip        IN CNAME *.
+128.1.zz.db8.2001.rpz-ip   IN CNAME .
+ns1.evil.test.rpz-nsdname  IN CNAME .
+`
+
+func TestReadPolicyZone(t *testing.T) {
+	z, err := ReadPolicyZone(strings.NewReader(testPolicyZone), "rpz.example")
+	st.Assert(t, err, nil)
+	st.Expect(t, z.matchQName("blocked.example.com.").action, ActionNXDOMAIN)
+	st.Expect(t, z.matchQName("nodata.example.com.").action, ActionNODATA)
+	st.Expect(t, z.matchQName("a.b.wild.test.").action, ActionNXDOMAIN)
+	st.Expect(t, z.matchQName("wild.test.") == nil, true)
+	st.Expect(t, z.matchQName("ok.wild.test.").action, ActionPassthru)
+	st.Expect(t, z.matchQName("rewrite.test.").action, ActionLocalData)
+	st.Expect(t, len(z.matchQName("local.test.").data), 2)
+	st.Expect(t, z.matchQName("www.example.com.") == nil, true)
+	st.Expect(t, z.matchNSDName("ns1.evil.test.").action, ActionNXDOMAIN)
+
+	st.Expect(t, parsePolicyIP("32.1.2.0.192").String(), "192.0.2.1/32")
+	st.Expect(t, parsePolicyIP("24.0.2.0.192").String(), "192.0.2.0/24")
+	st.Expect(t, parsePolicyIP("128.1.zz.db8.2001").String(), "2001:db8::1/128")
+	st.Expect(t, parsePolicyIP("48.zz.db8.2001").String(), "2001:db8::/48")
+	st.Expect(t, parsePolicyIP("99.1.2.0.192") == nil, true)
+
+	rule := z.matchIP(net.ParseIP("192.0.2.2"))
+	st.Expect(t, rule.name, "192.0.2.2/32")
+	st.Expect(t, rule.action, ActionNODATA)
+	st.Expect(t, z.matchIP(net.ParseIP("192.0.2.3")).name, "192.0.2.0/24")
+	st.Expect(t, z.matchIP(net.ParseIP("2001:db8::1")).action, ActionNXDOMAIN)
+	st.Expect(t, z.matchIP(net.ParseIP("198.51.100.1")) == nil, true)
+
+	err = z.Reload(strings.NewReader("blocked.example.com IN CNAME *.\n"))
+	st.Expect(t, err, nil)
+	st.Expect(t, z.matchQName("blocked.example.com.").action, ActionNODATA)
+	st.Expect(t, z.matchQName("nodata.example.com.") == nil, true)
+	err = z.Reload(strings.NewReader("blocked.example.com IN A nope\n"))
+	st.Expect(t, err != nil, true)
+	st.Expect(t, z.matchQName("blocked.example.com.").action, ActionNODATA)
+}
+
+func TestPolicyZones(t *testing.T) {
+	n := newTestNet(t)
+	n.server("192.0.2.53").add(t, `
+blocked.example.com.  IN A 192.0.2.66
+other.example.com.    IN A 192.0.2.3
+`)
+	z, err := ReadPolicyZone(strings.NewReader(testPolicyZone), "rpz.example")
+	st.Assert(t, err, nil)
+	var m sync.Mutex
+	var hits []PolicyHit
+	r := newTestResolver(n, WithPolicyZones(z), WithPolicyHook(func(hit PolicyHit) {
+		m.Lock()
+		defer m.Unlock()
+		hits = append(hits, hit)
+	}))
+
+	// QNAME triggers are applied before resolution
+	_, err = r.ResolveErr("blocked.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, n.server("192.0.2.53").count("blocked.example.com."), 0)
+	rrs, err := r.ResolveErr("nodata.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 0)
+	rrs, err = r.ResolveErr("local.test", "TXT")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "local.test.", Type: "TXT", Value: `"local data"`}})
+	rrs, err = r.ResolveErr("rewrite.test", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs[0], RR{Name: "rewrite.test.", Type: "CNAME", Value: "www.example.com."})
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "192.0.2.2" }), 1)
+
+	// Response IP triggers are applied after resolution
+	rrs, err = r.ResolveErr("other.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, len(rrs), 0)
+
+	m.Lock()
+	st.Expect(t, len(hits), 5)
+	st.Expect(t, hits[0], PolicyHit{Zone: "rpz.example.", QName: "blocked.example.com.", QType: "A", Trigger: TriggerQName, Rule: "blocked.example.com.", Action: ActionNXDOMAIN})
+	st.Expect(t, hits[4], PolicyHit{Zone: "rpz.example.", QName: "other.example.com.", QType: "A", Trigger: TriggerResponseIP, Rule: "192.0.2.0/24", Action: ActionNXDOMAIN})
+	m.Unlock()
+}
+
+func TestPolicyNSDName(t *testing.T) {
+	n := newTestNet(t)
+	z, err := ReadPolicyZone(strings.NewReader("ns1.example.com.rpz-nsdname IN CNAME .\n"), "rpz.example")
+	st.Assert(t, err, nil)
+	r := newTestResolver(n, WithPolicyZones(z))
+	_, err = r.ResolveErr("www.example.com", "TXT")
+	st.Expect(t, err, NXDOMAIN)
+}
+
+func TestPolicyPassthru(t *testing.T) {
+	n := newTestNet(t)
+	pass, err := ReadPolicyZone(strings.NewReader("www.example.com IN CNAME rpz-passthru.\n"), "pass.example")
+	st.Assert(t, err, nil)
+	block, err := ReadPolicyZone(strings.NewReader("32.2.2.0.192.rpz-ip IN CNAME .\n"), "block.example")
+	st.Assert(t, err, nil)
+	r := newTestResolver(n, WithPolicyZones(pass, block))
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Value == "192.0.2.2" }), 1)
+
+	r = newTestResolver(n, WithPolicyZones(block))
+	_, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+}
@@ -2,6 +2,7 @@ package dnsr
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -9,12 +10,15 @@ import (
 )
 
 // RR represents a DNS resource record.
+// Class is empty for records in class IN.
+// The Value of a TXT record is in zone-file format; see TXTSegments.
 type RR struct {
 	Name   string
 	Type   string
 	Value  string
 	TTL    time.Duration
 	Expiry time.Time
+	Class  string
 }
 
 // RRs represents a slice of DNS resource records.
@@ -35,13 +39,68 @@ const NameCollision = "127.0.53.53"
 // String returns a string representation of an RR in zone-file format.
 func (rr *RR) String() string {
 	if rr.Expiry.IsZero() {
-		return rr.Name + "\t      3600\tIN\t" + rr.Type + "\t" + rr.Value
+		return rr.Name + "\t      3600\t" + rr.class() + "\t" + rr.Type + "\t" + rr.Value
 	} else {
 		ttl := ttlString(rr.TTL)
-		return rr.Name + "\t" + ttl + "\tIN\t" + rr.Type + "\t" + rr.Value
+		return rr.Name + "\t" + ttl + "\t" + rr.class() + "\t" + rr.Type + "\t" + rr.Value
 	}
 }
 
+// class returns the class of rr, such as IN or CH.
+func (rr *RR) class() string {
+	if rr.Class == "" {
+		return "IN"
+	}
+	return rr.Class
+}
+
+// ToDNS converts rr to a dns.RR, by parsing rr in zone-file format.
+// The TTL is 3600 seconds if rr does not expire, as in String.
+// SOA records keep only the primary name server, in Value; the other
+// SOA fields are empty.
+func (rr *RR) ToDNS() (dns.RR, error) {
+	ttl := "3600"
+	if !rr.Expiry.IsZero() {
+		ttl = strconv.Itoa(int(rr.TTL.Seconds()))
+	}
+	drr, err := dns.NewRR(rr.Name + "\t" + ttl + "\t" + rr.class() + "\t" + rr.Type + "\t" + rr.rdata())
+	if err != nil {
+		return nil, err
+	}
+	if drr == nil {
+		return nil, ErrRData
+	}
+	return drr, nil
+}
+
+// rdata returns the record data of rr in zone-file format.
+func (rr *RR) rdata() string {
+	switch rr.Type {
+	case "TXT":
+		if !strings.HasPrefix(rr.Value, `"`) {
+			return quoteTXT(strings.Split(rr.Value, "\t"))
+		}
+	case "SOA":
+		return rr.Value + " . 0 0 0 0 0"
+	}
+	return rr.Value
+}
+
+// ToMsg returns a DNS response message with rrs in the answer section.
+// Pack the message to convert rrs to wire format.
+func (rrs RRs) ToMsg() (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.Response = true
+	for i := range rrs {
+		drr, err := rrs[i].ToDNS()
+		if err != nil {
+			return nil, err
+		}
+		msg.Answer = append(msg.Answer, drr)
+	}
+	return msg, nil
+}
+
 // ttlString constructs the TTL field of an RR string.
 func ttlString(ttl time.Duration) string {
 	seconds := int(ttl.Seconds())
@@ -49,40 +108,45 @@ func ttlString(ttl time.Duration) string {
 }
 
 // convertRR converts a dns.RR to an RR.
+// If now is not zero, the TTL and expiry of the RR are set, relative to now.
 // If the RR is not a type that this package uses,
 // It will attempt to translate this if there are enough parameters
 // Should all translation fail, it returns an undefined RR and false.
-func convertRR(drr dns.RR, expire bool) (RR, bool) {
+func convertRR(drr dns.RR, now time.Time) (RR, bool) {
 	var ttl time.Duration
 	var expiry time.Time
-	if expire {
-		ttl, expiry = calculateExpiry(drr)
+	if !now.IsZero() {
+		ttl, expiry = calculateExpiry(drr, now)
+	}
+	var class string
+	if c := drr.Header().Class; c != dns.ClassINET {
+		class = classString(c)
 	}
 	switch t := drr.(type) {
 	case *dns.SOA:
-		return RR{toLowerFQDN(t.Hdr.Name), "SOA", toLowerFQDN(t.Ns), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "SOA", toLowerFQDN(t.Ns), ttl, expiry, class}, true
 	case *dns.NS:
-		return RR{toLowerFQDN(t.Hdr.Name), "NS", toLowerFQDN(t.Ns), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "NS", toLowerFQDN(t.Ns), ttl, expiry, class}, true
 	case *dns.CNAME:
-		return RR{toLowerFQDN(t.Hdr.Name), "CNAME", toLowerFQDN(t.Target), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "CNAME", toLowerFQDN(t.Target), ttl, expiry, class}, true
 	case *dns.A:
-		return RR{toLowerFQDN(t.Hdr.Name), "A", t.A.String(), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "A", t.A.String(), ttl, expiry, class}, true
 	case *dns.AAAA:
-		return RR{toLowerFQDN(t.Hdr.Name), "AAAA", t.AAAA.String(), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "AAAA", t.AAAA.String(), ttl, expiry, class}, true
 	case *dns.TXT:
-		return RR{toLowerFQDN(t.Hdr.Name), "TXT", strings.Join(t.Txt, "\t"), ttl, expiry}, true
+		return RR{toLowerFQDN(t.Hdr.Name), "TXT", quoteTXT(t.Txt), ttl, expiry, class}, true
 	default:
-		fields := strings.Fields(drr.String())
+		fields := splitFields(drr.String())
 		if len(fields) >= 4 {
-			return RR{toLowerFQDN(fields[0]), fields[3], strings.Join(fields[4:], "\t"), ttl, expiry}, true
+			return RR{toLowerFQDN(fields[0]), fields[3], strings.Join(fields[4:], "\t"), ttl, expiry, class}, true
 		}
 	}
 	return RR{}, false
 }
 
 // calculateExpiry calculates the expiry time of an RR.
-func calculateExpiry(drr dns.RR) (time.Duration, time.Time) {
+func calculateExpiry(drr dns.RR, now time.Time) (time.Duration, time.Time) {
 	ttl := time.Second * time.Duration(drr.Header().Ttl)
-	expiry := time.Now().Add(ttl)
+	expiry := now.Add(ttl)
 	return ttl, expiry
 }
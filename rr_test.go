@@ -1,9 +1,12 @@
 package dnsr
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/nbio/st"
 )
 
@@ -29,3 +32,80 @@ func TestRRStringExpiring(t *testing.T) {
 	result := rr.String()
 	st.Expect(t, result, "example.com.	     86400	IN	A	203.0.113.1")
 }
+
+func TestRRToDNS(t *testing.T) {
+	tests := []string{
+		"example.com. 300 IN A 192.0.2.1",
+		"example.com. 300 IN AAAA 2001:db8::1",
+		"example.com. 300 IN NS ns1.example.com.",
+		"www.example.com. 300 IN CNAME example.com.",
+		"example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 1 2 3 4 5",
+		`example.com. 300 IN TXT "v=spf1 -all"`,
+		`example.com. 300 IN TXT "hello" "world"`,
+		`example.com. 300 IN TXT "quote \" backslash \\"`,
+		`example.com. 300 IN TXT "tab\009byte\255"`,
+		"1.2.0.192.in-addr.arpa. 300 IN PTR host.example.com.",
+		"example.com. 300 IN MX 10 mail.example.com.",
+		"_sip._tcp.example.com. 300 IN SRV 10 20 5060 sip.example.com.",
+		`example.com. 300 IN CAA 0 issue "letsencrypt.org"`,
+		`example.com. 300 IN NAPTR 100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+		"_443._tcp.example.com. 300 IN TLSA 3 1 1 0d6fce3375",
+		"example.com. 300 IN SSHFP 4 2 8e1f",
+		"example.com. 300 IN DS 12345 13 2 c0ffee",
+		"example.com. 300 IN DNSKEY 257 3 13 AQID",
+		`example.com. 300 IN TYPE65 \# 3 000100`,
+		`version.bind. 300 CH TXT "9.18.0"`,
+		`example.com. 300 HS A 192.0.2.1`,
+	}
+	for _, s := range tests {
+		drr, err := dns.NewRR(s)
+		st.Assert(t, err, nil)
+		for _, now := range []time.Time{{}, time.Now()} {
+			rr, ok := convertRR(drr, now)
+			st.Assert(t, ok, true)
+			drr2, err := rr.ToDNS()
+			st.Assert(t, err, nil)
+			rr2, ok := convertRR(drr2, now)
+			st.Expect(t, ok, true)
+			st.Expect(t, rr2, rr)
+			if rr.Type != "SOA" {
+				st.Expect(t, drr2.String(), strings.Replace(drr.String(), "\t300\t", "\t"+strconv.Itoa(int(drr2.Header().Ttl))+"\t", 1))
+			}
+		}
+	}
+}
+
+func TestRRsToMsg(t *testing.T) {
+	var rrs RRs
+	for _, s := range []string{
+		"www.example.com. 300 IN CNAME example.com.",
+		"example.com. 300 IN A 192.0.2.1",
+		`example.com. 300 IN TXT "hello world" "again"`,
+		"example.com. 300 IN MX 10 mail.example.com.",
+	} {
+		drr, err := dns.NewRR(s)
+		st.Assert(t, err, nil)
+		rr, _ := convertRR(drr, time.Now())
+		rrs = append(rrs, rr)
+	}
+	msg, err := rrs.ToMsg()
+	st.Assert(t, err, nil)
+	msg.SetQuestion("www.example.com.", dns.TypeA)
+	wire, err := msg.Pack()
+	st.Assert(t, err, nil)
+	msg2 := &dns.Msg{}
+	st.Assert(t, msg2.Unpack(wire), nil)
+	st.Expect(t, msg2.Response, true)
+	st.Assert(t, len(msg2.Answer), len(rrs))
+	for i, drr := range msg2.Answer {
+		rr, ok := convertRR(drr, time.Time{})
+		st.Expect(t, ok, true)
+		st.Expect(t, rr.Name, rrs[i].Name)
+		st.Expect(t, rr.Type, rrs[i].Type)
+		st.Expect(t, rr.Value, rrs[i].Value)
+		st.Expect(t, drr.Header().Ttl, uint32(300))
+	}
+
+	_, err = RRs{{Name: "example.com.", Type: "MX", Value: "bogus"}}.ToMsg()
+	st.Expect(t, err != nil, true)
+}
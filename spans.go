@@ -0,0 +1,74 @@
+package dnsr
+
+import (
+	"context"
+)
+
+// Tracer starts spans for distributed tracing. It is modelled on
+// OpenTelemetry, without depending on a tracing SDK: implement Tracer
+// with an adapter for the SDK in use. A Resolver with a Tracer starts
+// a span for each level of recursion in a resolution, named "dnsr.resolve",
+// and for each query to a name server, named "dnsr.exchange". Spans are
+// propagated through the context passed to ResolveCtx.
+type Tracer interface {
+	// Start starts a span with name and attributes, as a child of the
+	// span in ctx, if any, and returns a context containing the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key-value pair describing a Span.
+// Values are strings, ints or bools.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attribute keys set on spans.
+const (
+	AttrQName    = "dns.qname"
+	AttrQType    = "dns.qtype"
+	AttrDepth    = "dns.depth"
+	AttrCacheHit = "dns.cache_hit"
+	AttrZone     = "dns.zone"
+	AttrServer   = "dns.server"
+	AttrAddr     = "net.peer.addr"
+	AttrRcode    = "dns.rcode"
+	AttrRRs      = "dns.rrs"
+)
+
+// WithTracer specifies a Tracer that receives spans for resolutions.
+func WithTracer(t Tracer) Option {
+	return func(r *Resolver) {
+		r.tracer = t
+	}
+}
+
+// noopSpan is the Span used when a Resolver has no Tracer.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// startSpan starts a span with r's Tracer, if any.
+func (r *Resolver) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if r.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return r.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
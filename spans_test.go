@@ -0,0 +1,125 @@
+package dnsr
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+// spanRecorder is a Tracer that records spans.
+type spanRecorder struct {
+	m     sync.Mutex
+	spans []*testSpan
+}
+
+type testSpan struct {
+	rec    *spanRecorder
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type spanKey struct{}
+
+func (rec *spanRecorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*testSpan)
+	s := &testSpan{rec: rec, name: name, parent: parent, attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs...)
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	rec.spans = append(rec.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	s.rec.m.Lock()
+	defer s.rec.m.Unlock()
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.rec.m.Lock()
+	defer s.rec.m.Unlock()
+	s.err = err
+}
+
+func (s *testSpan) End() {
+	s.rec.m.Lock()
+	defer s.rec.m.Unlock()
+	s.ended = true
+}
+
+// find returns the first recorded span matching f, or nil.
+func (rec *spanRecorder) find(f func(*testSpan) bool) *testSpan {
+	rec.m.Lock()
+	defer rec.m.Unlock()
+	for _, s := range rec.spans {
+		if f(s) {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestSpans(t *testing.T) {
+	rec := &spanRecorder{}
+	r := newTestResolver(newTestNet(t), WithTracer(rec))
+	_, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+
+	root := rec.find(func(s *testSpan) bool { return s.parent == nil })
+	st.Assert(t, root != nil, true)
+	rec.m.Lock()
+	st.Expect(t, root.name, "dnsr.resolve")
+	st.Expect(t, root.attrs[AttrQName], "www.example.com.")
+	st.Expect(t, root.attrs[AttrQType], "A")
+	st.Expect(t, root.attrs[AttrDepth], 1)
+	st.Expect(t, root.attrs[AttrCacheHit], false)
+	st.Expect(t, root.attrs[AttrRRs], 1)
+	st.Expect(t, root.ended, true)
+	rec.m.Unlock()
+
+	x := rec.find(func(s *testSpan) bool {
+		return s.name == "dnsr.exchange" && s.attrs[AttrZone] == "example.com." && s.attrs[AttrQType] == "A" && s.attrs[AttrRcode] == "NOERROR"
+	})
+	st.Assert(t, x != nil, true)
+	rec.m.Lock()
+	st.Expect(t, x.parent != nil && x.parent.name == "dnsr.resolve", true)
+	st.Expect(t, x.attrs[AttrQName], "www.example.com.")
+	st.Expect(t, x.attrs[AttrAddr] != "", true)
+	rec.m.Unlock()
+
+	child := rec.find(func(s *testSpan) bool {
+		return s.name == "dnsr.resolve" && s.parent != nil && s.parent.name == "dnsr.resolve"
+	})
+	st.Assert(t, child != nil, true)
+	rec.m.Lock()
+	st.Expect(t, child.attrs[AttrDepth], child.parent.attrs[AttrDepth].(int)+1)
+	rec.m.Unlock()
+
+	_, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	hit := rec.find(func(s *testSpan) bool { return s.parent == nil && s != root })
+	st.Assert(t, hit != nil, true)
+	rec.m.Lock()
+	st.Expect(t, hit.attrs[AttrCacheHit], true)
+	rec.m.Unlock()
+}
+
+func TestSpansError(t *testing.T) {
+	rec := &spanRecorder{}
+	r := newTestResolver(newTestNet(t), WithTracer(rec))
+	_, err := r.ResolveErr("nope.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	root := rec.find(func(s *testSpan) bool { return s.parent == nil })
+	st.Assert(t, root != nil, true)
+	rec.m.Lock()
+	st.Expect(t, root.err, NXDOMAIN)
+	rec.m.Unlock()
+}
@@ -0,0 +1,61 @@
+package dnsr
+
+import (
+	"sync/atomic"
+)
+
+// Stats contains counters of notable Resolver events.
+type Stats struct {
+	// Queries is the number of queries sent to name servers.
+	Queries uint64
+
+	// BudgetExceeded is the number of resolutions that failed with
+	// ErrMaxQueries.
+	BudgetExceeded uint64
+
+	// SubResolutionsExceeded is the number of resolutions that failed
+	// with ErrMaxSubResolutions.
+	SubResolutionsExceeded uint64
+
+	// Mismatches is the number of responses rejected because they did
+	// not match the ID, question or 0x20 case of the query.
+	Mismatches uint64
+
+	// OutOfBailiwick is the number of records rejected because they were
+	// outside of the zone of the name server that returned them,
+	// including out-of-bailiwick glue, which is used only as hints.
+	OutOfBailiwick uint64
+
+	// InvalidReferrals is the number of NS records rejected because they
+	// did not delegate to a zone cut below the zone of the name server,
+	// including referrals with no valid NS records, which are also
+	// counted in LameDelegations.
+	InvalidReferrals uint64
+
+	// LameDelegations is the number of responses from name servers
+	// that were lame or broken for the zone they were queried for.
+	LameDelegations uint64
+
+	// RootZoneAnswers is the number of queries answered from a local copy
+	// of the root zone, instead of the root name servers.
+	RootZoneAnswers uint64
+
+	// LocalAnswers is the number of queries answered from local records.
+	LocalAnswers uint64
+}
+
+// Stats returns a snapshot of the counters for r.
+// Safe for concurrent usage.
+func (r *Resolver) Stats() Stats {
+	return Stats{
+		Queries:                atomic.LoadUint64(&r.stats.Queries),
+		BudgetExceeded:         atomic.LoadUint64(&r.stats.BudgetExceeded),
+		SubResolutionsExceeded: atomic.LoadUint64(&r.stats.SubResolutionsExceeded),
+		Mismatches:             atomic.LoadUint64(&r.stats.Mismatches),
+		OutOfBailiwick:         atomic.LoadUint64(&r.stats.OutOfBailiwick),
+		InvalidReferrals:       atomic.LoadUint64(&r.stats.InvalidReferrals),
+		LameDelegations:        atomic.LoadUint64(&r.stats.LameDelegations),
+		RootZoneAnswers:        atomic.LoadUint64(&r.stats.RootZoneAnswers),
+		LocalAnswers:           atomic.LoadUint64(&r.stats.LocalAnswers),
+	}
+}
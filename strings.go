@@ -1,6 +1,8 @@
 package dnsr
 
 import (
+	"crypto/rand"
+	"net"
 	"strings"
 
 	"github.com/miekg/dns"
@@ -14,6 +16,53 @@ func parent(name string) (string, bool) {
 	return toLowerFQDN(strings.Join(labels[1:], ".")), true
 }
 
+// inBailiwick returns true if name is equal to or below zone.
+func inBailiwick(name, zone string) bool {
+	return dns.IsSubDomain(zone, name)
+}
+
+// isZoneCut returns true if cut is a valid delegation from zone
+// for qname: strictly below zone, and equal to or above qname.
+func isZoneCut(cut, zone, qname string) bool {
+	return cut != zone && inBailiwick(cut, zone) && inBailiwick(qname, cut)
+}
+
 func toLowerFQDN(name string) string {
 	return dns.Fqdn(strings.ToLower(name))
 }
+
+// randomizeCase randomly flips the case of each letter in name,
+// for DNS 0x20 encoding of outgoing queries.
+func randomizeCase(name string) string {
+	b := []byte(name)
+	bits := make([]byte, (len(b)+7)/8)
+	if _, err := rand.Read(bits); err != nil {
+		return name
+	}
+	for i, c := range b {
+		if bits[i/8]&(1<<uint(i%8)) == 0 {
+			continue
+		}
+		switch {
+		case 'a' <= c && c <= 'z':
+			b[i] = c - ('a' - 'A')
+		case 'A' <= c && c <= 'Z':
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// hostPort returns addr with the default DNS port 53 if it has no port.
+// IPv6 addresses without a port may omit the square brackets.
+func hostPort(addr string) string {
+	return withPort(addr, "53")
+}
+
+// withPort returns addr with the default port if it has no port.
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(strings.Trim(addr, "[]"), port)
+}
@@ -1,6 +1,7 @@
 package dnsr
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/nbio/st"
@@ -11,3 +12,39 @@ func TestToLowerFQDN(t *testing.T) {
 	st.Expect(t, toLowerFQDN("boO.net"), "boo.net.")
 	st.Expect(t, toLowerFQDN("just.another.HORSE"), "just.another.horse.")
 }
+
+func TestRandomizeCase(t *testing.T) {
+	name := "abcdefghijklmnopqrstuvwxyz.example.com."
+	st.Expect(t, strings.ToLower(randomizeCase(name)), name)
+	mixed := false
+	for i := 0; i < 10 && !mixed; i++ {
+		mixed = randomizeCase(name) != name
+	}
+	st.Expect(t, mixed, true)
+	st.Expect(t, randomizeCase("1-2.3."), "1-2.3.")
+}
+
+func TestInBailiwick(t *testing.T) {
+	st.Expect(t, inBailiwick("www.example.com.", "example.com."), true)
+	st.Expect(t, inBailiwick("example.com.", "example.com."), true)
+	st.Expect(t, inBailiwick("www.example.com.", "."), true)
+	st.Expect(t, inBailiwick("www.google.com.", "example.com."), false)
+	st.Expect(t, inBailiwick("com.", "example.com."), false)
+	st.Expect(t, inBailiwick("badexample.com.", "example.com."), false)
+}
+
+func TestIsZoneCut(t *testing.T) {
+	st.Expect(t, isZoneCut("example.com.", "com.", "www.example.com."), true)
+	st.Expect(t, isZoneCut("example.com.", "com.", "example.com."), true)
+	st.Expect(t, isZoneCut("com.", "com.", "www.example.com."), false)
+	st.Expect(t, isZoneCut("com.", "example.com.", "www.example.com."), false)
+	st.Expect(t, isZoneCut("example.net.", "net.", "www.example.com."), false)
+}
+
+func TestHostPort(t *testing.T) {
+	st.Expect(t, hostPort("192.0.2.1"), "192.0.2.1:53")
+	st.Expect(t, hostPort("192.0.2.1:5353"), "192.0.2.1:5353")
+	st.Expect(t, hostPort("2001:db8::1"), "[2001:db8::1]:53")
+	st.Expect(t, hostPort("[2001:db8::1]"), "[2001:db8::1]:53")
+	st.Expect(t, hostPort("[2001:db8::1]:5353"), "[2001:db8::1]:5353")
+}
@@ -0,0 +1,13 @@
+
+)
+example.com.A	192.0.2.1 (𺗹
+5
+example.com.MX10	mail.example.com. (ÊҾ
+@
+example.com.TXT"v=DKIM1; k=rsa; " "p=MIGf\"\\" <(Ŏ
+'
+example.com.TYPE65\# 5 0001000001
+
+com.NSa.gtld-servers.net.
+"
+version.bind.TXT"9.18.0"2CH
\ No newline at end of file
@@ -0,0 +1,243 @@
+package dnsr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testNet is an in-process network of authoritative name servers,
+// used to test resolution without touching the Internet.
+type testNet struct {
+	m       sync.Mutex
+	servers map[string]*testServer
+}
+
+// testServer is a minimal authoritative name server for one or more zones.
+type testServer struct {
+	rrs []dns.RR
+
+	// rewrite, if not nil, can modify or replace each response.
+	rewrite func(qmsg, rmsg *dns.Msg) *dns.Msg
+
+	m       sync.Mutex
+	queries []dns.Question
+}
+
+var errTestUnreachable = errors.New("test network: host unreachable")
+
+// newTestNet returns a testNet with a root, com. and example.com. server.
+// The root server answers on the IPv4 and IPv6 addresses in the compiled-in
+// root hints.
+func newTestNet(t *testing.T) *testNet {
+	n := &testNet{servers: make(map[string]*testServer)}
+	root := n.add(t, `
+.                   IN SOA a.root-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400
+.                   IN NS  a.root-servers.net.
+a.root-servers.net. IN A   198.41.0.4
+com.                IN NS  a.gtld-servers.net.
+com.                IN NS  b.gtld-servers.net.
+a.gtld-servers.net. IN A   192.5.6.30
+b.gtld-servers.net. IN A   192.33.14.30
+`)
+	for _, rr := range rootCache.get(".") {
+		for _, arr := range rootCache.get(rr.Value) {
+			if arr.Type == "A" || arr.Type == "AAAA" {
+				n.servers[hostPort(arr.Value)] = root
+			}
+		}
+	}
+	n.add(t, `
+com.                IN SOA a.gtld-servers.net. nstld.verisign-grs.com. 1 1800 900 604800 86400
+com.                IN NS  a.gtld-servers.net.
+com.                IN NS  b.gtld-servers.net.
+example.com.        IN NS  ns1.example.com.
+example.com.        IN NS  ns2.example.com.
+ns1.example.com.    IN A   192.0.2.53
+ns2.example.com.    IN A   198.51.100.53
+`, "192.5.6.30", "192.33.14.30")
+	n.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+example.com.        IN NS  ns1.example.com.
+example.com.        IN NS  ns2.example.com.
+ns1.example.com.    IN A   192.0.2.53
+ns2.example.com.    IN A   198.51.100.53
+example.com.        IN A   192.0.2.1
+www.example.com.    IN A   192.0.2.2
+www.example.com.    IN TXT "hello world"
+alias.example.com.  IN CNAME www.example.com.
+`, "192.0.2.53", "198.51.100.53")
+	return n
+}
+
+// add parses zone and adds a testServer answering on each IP address in ips,
+// with an optional port.
+func (n *testNet) add(t *testing.T, zone string, ips ...string) *testServer {
+	s := &testServer{}
+	s.add(t, zone)
+	n.m.Lock()
+	defer n.m.Unlock()
+	for _, ip := range ips {
+		n.servers[hostPort(ip)] = s
+	}
+	return s
+}
+
+// add parses zone and adds its records to s.
+func (s *testServer) add(t *testing.T, zone string) {
+	for tok := range dns.ParseZone(strings.NewReader(zone), ".", "") {
+		if tok.Error != nil {
+			t.Fatalf("invalid test zone: %s", tok.Error)
+		}
+		s.rrs = append(s.rrs, tok.RR)
+	}
+}
+
+// server returns the testServer answering on ip, with an optional port.
+func (n *testNet) server(ip string) *testServer {
+	n.m.Lock()
+	defer n.m.Unlock()
+	return n.servers[hostPort(ip)]
+}
+
+// exchange implements exchanger. Messages are packed and unpacked to simulate the wire.
+func (n *testNet) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	n.m.Lock()
+	s := n.servers[addr]
+	n.m.Unlock()
+	if s == nil {
+		return nil, 0, errTestUnreachable
+	}
+	q, err := wireCopy(qmsg)
+	if err != nil {
+		return nil, 0, err
+	}
+	rmsg := s.answer(q)
+	if s.rewrite != nil {
+		rmsg = s.rewrite(q, rmsg)
+	}
+	if rmsg == nil {
+		return nil, 0, errTestUnreachable
+	}
+	rmsg, err = wireCopy(rmsg)
+	return rmsg, time.Millisecond, err
+}
+
+// count returns the number of queries received for qname.
+func (s *testServer) count(qname string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	n := 0
+	for _, q := range s.queries {
+		if strings.EqualFold(q.Name, qname) {
+			n++
+		}
+	}
+	return n
+}
+
+// answer responds to q as an authoritative name server.
+// Records are copied, since packing a message modifies them.
+func (s *testServer) answer(q *dns.Msg) *dns.Msg {
+	rmsg := &dns.Msg{}
+	rmsg.SetReply(q)
+	if len(q.Question) != 1 {
+		rmsg.Rcode = dns.RcodeFormatError
+		return rmsg
+	}
+	s.m.Lock()
+	s.queries = append(s.queries, q.Question[0])
+	s.m.Unlock()
+	qname := toLowerFQDN(q.Question[0].Name)
+	qtype := q.Question[0].Qtype
+
+	// Find the closest enclosing zone
+	var soa dns.RR
+	for _, rr := range s.rrs {
+		if rr.Header().Rrtype == dns.TypeSOA && dns.IsSubDomain(rr.Header().Name, qname) &&
+			(soa == nil || dns.CountLabel(rr.Header().Name) > dns.CountLabel(soa.Header().Name)) {
+			soa = rr
+		}
+	}
+	if soa == nil {
+		rmsg.Rcode = dns.RcodeRefused
+		return rmsg
+	}
+	zone := soa.Header().Name
+
+	// Refer to the first zone cut below zone
+	var cut string
+	for _, rr := range s.rrs {
+		name := rr.Header().Name
+		if rr.Header().Rrtype == dns.TypeNS && name != zone && dns.IsSubDomain(name, qname) && dns.IsSubDomain(zone, name) &&
+			(cut == "" || dns.CountLabel(name) < dns.CountLabel(cut)) {
+			cut = name
+		}
+	}
+	if cut != "" {
+		for _, rr := range s.rrs {
+			if rr.Header().Rrtype == dns.TypeNS && rr.Header().Name == cut {
+				rmsg.Ns = append(rmsg.Ns, dns.Copy(rr))
+				rmsg.Extra = append(rmsg.Extra, s.lookup(rr.(*dns.NS).Ns, dns.TypeA)...)
+			}
+		}
+		return rmsg
+	}
+
+	rmsg.Authoritative = true
+	exists := false
+	for _, rr := range s.rrs {
+		if dns.IsSubDomain(qname, rr.Header().Name) {
+			exists = true
+		}
+		if rr.Header().Name != qname {
+			continue
+		}
+		if rr.Header().Rrtype == qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			rmsg.Answer = append(rmsg.Answer, dns.Copy(rr))
+			if ns, ok := rr.(*dns.NS); ok {
+				rmsg.Extra = append(rmsg.Extra, s.lookup(ns.Ns, dns.TypeA)...)
+			}
+		}
+	}
+	if len(rmsg.Answer) == 0 {
+		if !exists {
+			rmsg.Rcode = dns.RcodeNameError
+		}
+		rmsg.Ns = append(rmsg.Ns, dns.Copy(soa))
+	}
+	return rmsg
+}
+
+// lookup returns records in s matching name and rrtype.
+func (s *testServer) lookup(name string, rrtype uint16) []dns.RR {
+	var rrs []dns.RR
+	for _, rr := range s.rrs {
+		if rr.Header().Name == name && rr.Header().Rrtype == rrtype {
+			rrs = append(rrs, dns.Copy(rr))
+		}
+	}
+	return rrs
+}
+
+// wireCopy returns a copy of msg after a round trip through wire format.
+func wireCopy(msg *dns.Msg) (*dns.Msg, error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	out := &dns.Msg{}
+	return out, out.Unpack(b)
+}
+
+// newTestResolver returns a Resolver that queries n instead of the network.
+func newTestResolver(n *testNet, options ...Option) *Resolver {
+	r := NewResolver(options...)
+	r.exchanger = n
+	return r
+}
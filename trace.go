@@ -0,0 +1,144 @@
+package dnsr
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Trace is a structured record of a single resolution: each resolution
+// step, zone cut, name server queried and cache hit, in order.
+// It can be serialized to JSON.
+type Trace struct {
+	QName    string        `json:"qname"`
+	QType    string        `json:"qtype"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_ns"`
+	RRs      RRs           `json:"rrs,omitempty"`
+	Err      string        `json:"error,omitempty"`
+	Steps    []TraceStep   `json:"steps"`
+}
+
+// Kinds of TraceStep.
+const (
+	TraceResolve   = "resolve"   // a resolution ended
+	TraceCache     = "cache"     // a cache hit
+	TraceExchange  = "exchange"  // a query to a name server
+	TraceReferral  = "referral"  // a referral to a zone cut
+	TraceCNAME     = "cname"     // a CNAME record was followed
+	TraceLame      = "lame"      // a name server was marked lame
+	TraceRejected  = "rejected"  // a response or record was rejected
+	TraceRootZone  = "root-zone" // an answer from the local root zone
+	TracePolicy    = "policy"    // a response policy zone hit
+	TraceRecursion = "max-recursion"
+)
+
+// TraceStep is a step in a Trace. Fields that do not apply
+// to the Kind of step are empty.
+type TraceStep struct {
+	Kind        string        `json:"kind"`
+	Depth       int           `json:"depth"`
+	QName       string        `json:"qname,omitempty"`
+	QType       string        `json:"qtype,omitempty"`
+	Zone        string        `json:"zone,omitempty"`
+	Server      string        `json:"server,omitempty"`
+	IP          string        `json:"ip,omitempty"`
+	RTT         time.Duration `json:"rtt_ns,omitempty"`
+	Rcode       string        `json:"rcode,omitempty"`
+	Answer      int           `json:"answer,omitempty"`
+	Authority   int           `json:"authority,omitempty"`
+	Additional  int           `json:"additional,omitempty"`
+	RRs         RRs           `json:"rrs,omitempty"`
+	NameServers []NameServer  `json:"nameservers,omitempty"`
+	Detail      string        `json:"detail,omitempty"`
+	Err         string        `json:"error,omitempty"`
+}
+
+// tracer is a Hook that records events into a Trace.
+type tracer struct {
+	m      sync.Mutex
+	trace  *Trace
+	closed bool
+}
+
+// ResolveTrace calls ResolveCtx and returns a trace of the resolution.
+// Queries still in flight when ResolveTrace returns are not traced.
+func (r *Resolver) ResolveTrace(ctx context.Context, qname, qtype string) (RRs, *Trace, error) {
+	t := &tracer{trace: &Trace{QName: toLowerFQDN(qname), QType: qtype, Start: r.clock.Now(), Steps: []TraceStep{}}}
+	rrs, err := r.ResolveCtx(ContextWithHook(ctx, t), qname, qtype)
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.closed = true
+	t.trace.Duration = r.clock.Now().Sub(t.trace.Start)
+	t.trace.RRs = rrs
+	if err != nil {
+		t.trace.Err = err.Error()
+	}
+	return rrs, t.trace, err
+}
+
+// Event implements Hook.
+func (t *tracer) Event(ctx context.Context, e Event) {
+	var s TraceStep
+	switch e := e.(type) {
+	case ResolveEndEvent:
+		s = TraceStep{Kind: TraceResolve, Depth: e.Depth, QName: e.QName, QType: e.QType, RTT: e.Duration, RRs: e.RRs, Err: errString(e.Err)}
+	case CacheHitEvent:
+		s = TraceStep{Kind: TraceCache, Depth: e.Depth, QName: e.QName, QType: e.QType, RRs: e.RRs, Err: errString(e.Err)}
+	case ExchangeReceivedEvent:
+		s = exchangeStep(e.Zone, e.Host, e.Addr, e.Query, e.Response, e.Depth, e.Duration, e.Err)
+	case ExchangeCancelledEvent:
+		s = exchangeStep(e.Zone, e.Host, e.Addr, e.Query, e.Response, e.Depth, e.Duration, context.Canceled)
+	case ReferralEvent:
+		s = TraceStep{Kind: TraceReferral, Depth: e.Depth, Zone: e.Zone, Server: e.Host, NameServers: e.NameServers}
+	case CNAMEFollowedEvent:
+		s = TraceStep{Kind: TraceCNAME, Depth: e.Depth, QName: e.CNAME.Name, RRs: RRs{e.CNAME}}
+	case LameEvent:
+		s = TraceStep{Kind: TraceLame, Depth: e.Depth, Zone: e.Zone, Server: e.Host, Detail: e.Reason}
+	case ResponseRejectedEvent:
+		s = TraceStep{Kind: TraceRejected, Depth: e.Depth, Server: e.Host, Err: errString(e.Err)}
+	case RecordRejectedEvent:
+		s = TraceStep{Kind: TraceRejected, Depth: e.Depth, Zone: e.Zone, Server: e.Host, Detail: e.Record.String(), Err: e.Reason}
+	case RootZoneEvent:
+		s = exchangeStep(".", "", "", e.Response, e.Response, e.Depth, 0, nil)
+		s.Kind = TraceRootZone
+	case PolicyEvent:
+		s = TraceStep{Kind: TracePolicy, QName: e.Hit.QName, QType: e.Hit.QType, Zone: e.Hit.Zone, Detail: e.Hit.Trigger.String() + " " + e.Hit.Rule + " " + e.Hit.Action.String()}
+	case MaxRecursionEvent:
+		s = TraceStep{Kind: TraceRecursion, Depth: e.Depth, QName: e.QName, QType: e.QType, Err: ErrMaxRecursion.Error()}
+	default:
+		return
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	if !t.closed {
+		t.trace.Steps = append(t.trace.Steps, s)
+	}
+}
+
+// exchangeStep returns a TraceStep for a query to a name server.
+func exchangeStep(zone, host, addr string, qmsg, rmsg *dns.Msg, depth int, rtt time.Duration, err error) TraceStep {
+	s := TraceStep{Kind: TraceExchange, Depth: depth, Zone: zone, Server: host, IP: addr, RTT: rtt, Err: errString(err)}
+	if ip, _, err := net.SplitHostPort(addr); err == nil {
+		s.IP = ip
+	}
+	if qmsg != nil && len(qmsg.Question) > 0 {
+		s.QName = qmsg.Question[0].Name
+		s.QType = dns.TypeToString[qmsg.Question[0].Qtype]
+	}
+	if rmsg != nil {
+		s.Rcode = dns.RcodeToString[rmsg.Rcode]
+		s.Answer, s.Authority, s.Additional = len(rmsg.Answer), len(rmsg.Ns), len(rmsg.Extra)
+	}
+	return s
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
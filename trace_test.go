@@ -0,0 +1,60 @@
+package dnsr
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestResolveTrace(t *testing.T) {
+	r := newTestResolver(newTestNet(t))
+	rrs, trace, err := r.ResolveTrace(context.Background(), "WWW.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rrs), 1)
+	st.Expect(t, trace.QName, "www.example.com.")
+	st.Expect(t, trace.RRs, rrs)
+	st.Expect(t, trace.Err, "")
+
+	var exchange, referral *TraceStep
+	for i := range trace.Steps {
+		s := &trace.Steps[i]
+		if s.Kind == TraceExchange && s.Zone == "example.com." && s.QName == "www.example.com." && s.Rcode == "NOERROR" {
+			exchange = s
+		}
+		if s.Kind == TraceReferral && s.Zone == "example.com." {
+			referral = s
+		}
+	}
+	st.Assert(t, exchange != nil, true)
+	st.Expect(t, exchange.Depth, 1)
+	st.Expect(t, exchange.QType, "A")
+	st.Expect(t, exchange.Answer, 1)
+	st.Expect(t, exchange.IP == "192.0.2.53" || exchange.IP == "198.51.100.53", true)
+	st.Expect(t, exchange.Server == "ns1.example.com." || exchange.Server == "ns2.example.com.", true)
+	st.Assert(t, referral != nil, true)
+	st.Expect(t, referral.Server == "a.gtld-servers.net." || referral.Server == "b.gtld-servers.net.", true)
+	st.Expect(t, len(referral.NameServers), 2)
+	last := trace.Steps[len(trace.Steps)-1]
+	st.Expect(t, last.Kind, TraceResolve)
+	st.Expect(t, last.Depth, 1)
+
+	b, err := json.Marshal(trace)
+	st.Assert(t, err, nil)
+	var out Trace
+	st.Expect(t, json.Unmarshal(b, &out), nil)
+	st.Expect(t, out.QName, trace.QName)
+	st.Expect(t, len(out.Steps), len(trace.Steps))
+
+	// Cache hits
+	_, trace, err = r.ResolveTrace(context.Background(), "www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(trace.Steps), 1)
+	st.Expect(t, trace.Steps[0].Kind, TraceCache)
+	st.Expect(t, len(trace.Steps[0].RRs), 1)
+
+	_, trace, err = r.ResolveTrace(context.Background(), "nope.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, trace.Err, NXDOMAIN.Error())
+}
@@ -0,0 +1,334 @@
+package dnsr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Protocol is a transport used to query an upstream name server.
+type Protocol int
+
+const (
+	// ProtocolUDP queries over UDP, port 53 by default.
+	ProtocolUDP Protocol = iota
+
+	// ProtocolTLS queries over DNS over TLS (RFC 7858), port 853 by default.
+	ProtocolTLS
+
+	// ProtocolHTTPS queries over DNS over HTTPS (RFC 8484) with POST requests.
+	ProtocolHTTPS
+
+	// ProtocolHTTPSGet queries over DNS over HTTPS (RFC 8484) with GET requests.
+	ProtocolHTTPSGet
+)
+
+// UpstreamServer configures an upstream recursive name server
+// and the transport used to query it.
+type UpstreamServer struct {
+	// Addr is an IP address with an optional port for UDP and DNS over TLS,
+	// or an https URL for DNS over HTTPS, e.g. https://dns.example/dns-query.
+	Addr string
+
+	// Protocol is the transport used to query the name server.
+	Protocol Protocol
+
+	// ServerName is the name used to verify the certificate of a
+	// DNS over TLS server. If empty, the host part of Addr is used.
+	ServerName string
+
+	// TLSConfig, if not nil, is the TLS configuration for DNS over TLS
+	// and DNS over HTTPS, for example to specify root CAs.
+	TLSConfig *tls.Config
+
+	// Pins, if not empty, are base64-encoded SHA-256 digests of the
+	// SubjectPublicKeyInfo of trusted keys (RFC 7469). A connection
+	// is rejected unless a certificate in the server's chain matches a pin.
+	Pins []string
+}
+
+// Errors returned by DNS over TLS and DNS over HTTPS transports.
+var (
+	ErrPinMismatch = errors.New("no certificate matches a pinned public key")
+	ErrBadProtocol = errors.New("unknown upstream protocol")
+)
+
+// maxIdleConns is the maximum number of idle connections kept
+// for reuse by each DNS over TLS upstream name server.
+const maxIdleConns = 4
+
+// newTransport returns the exchanger for s, or nil for the
+// default UDP exchanger of a Resolver.
+func newTransport(s UpstreamServer) exchanger {
+	switch s.Protocol {
+	case ProtocolUDP:
+		return nil
+	case ProtocolTLS:
+		return newTLSExchanger(s)
+	case ProtocolHTTPS, ProtocolHTTPSGet:
+		return newHTTPSExchanger(s)
+	}
+	return errExchanger{ErrBadProtocol}
+}
+
+// protocolOf returns the Protocol of exchanger x.
+func protocolOf(x exchanger) Protocol {
+	switch x := x.(type) {
+	case *tlsExchanger:
+		return ProtocolTLS
+	case *httpsExchanger:
+		if x.get {
+			return ProtocolHTTPSGet
+		}
+		return ProtocolHTTPS
+	}
+	return ProtocolUDP
+}
+
+// tlsConfig returns the TLS configuration for s, with serverName
+// and public key pinning applied.
+func tlsConfig(s UpstreamServer, serverName string) *tls.Config {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = serverName
+	}
+	if len(s.Pins) > 0 {
+		config.VerifyPeerCertificate = verifyPins(s.Pins, config.VerifyPeerCertificate)
+	}
+	return config
+}
+
+// verifyPins returns a function for tls.Config.VerifyPeerCertificate that
+// requires a certificate with a public key matching one of pins.
+// The verified chains are checked if available, otherwise the certificates
+// presented by the server. If next is not nil, it is called as well.
+func verifyPins(pins []string, next func([][]byte, [][]*x509.Certificate) error) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if next != nil {
+			if err := next(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		var certs []*x509.Certificate
+		for _, chain := range verifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(verifiedChains) == 0 {
+			for _, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs = append(certs, cert)
+			}
+		}
+		for _, cert := range certs {
+			pin := SPKIPin(cert)
+			for _, p := range pins {
+				if p == pin {
+					return nil
+				}
+			}
+		}
+		return ErrPinMismatch
+	}
+}
+
+// SPKIPin returns the base64-encoded SHA-256 digest of the
+// SubjectPublicKeyInfo of cert, for use in UpstreamServer.Pins.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// errExchanger is an exchanger for a misconfigured upstream name server.
+type errExchanger struct {
+	err error
+}
+
+func (x errExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	return nil, 0, x.err
+}
+
+// tlsExchanger queries a name server over DNS over TLS (RFC 7858).
+// Connections are kept open and reused for later queries.
+type tlsExchanger struct {
+	config *tls.Config
+
+	m    sync.Mutex
+	idle []*dns.Conn
+}
+
+func newTLSExchanger(s UpstreamServer) *tlsExchanger {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		host = strings.Trim(s.Addr, "[]")
+	}
+	serverName := s.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	return &tlsExchanger{config: tlsConfig(s, serverName)}
+}
+
+func (x *tlsExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	for {
+		conn, reused := x.get()
+		if conn == nil {
+			client := &dns.Client{Net: "tcp-tls", TLSConfig: x.config, Timeout: time.Until(deadline)}
+			var err error
+			conn, err = client.Dial(withPort(addr, "853"))
+			if err != nil {
+				return nil, time.Since(start), err
+			}
+		}
+		conn.SetDeadline(deadline)
+		err := conn.WriteMsg(qmsg)
+		var rmsg *dns.Msg
+		if err == nil {
+			rmsg, err = conn.ReadMsg()
+		}
+		if err != nil {
+			conn.Close()
+			if reused && time.Now().Before(deadline) {
+				continue // The server may have closed an idle connection
+			}
+			return nil, time.Since(start), err
+		}
+		x.put(conn)
+		return rmsg, time.Since(start), nil
+	}
+}
+
+// get returns an idle connection, or nil.
+func (x *tlsExchanger) get() (*dns.Conn, bool) {
+	x.m.Lock()
+	defer x.m.Unlock()
+	if len(x.idle) == 0 {
+		return nil, false
+	}
+	conn := x.idle[len(x.idle)-1]
+	x.idle = x.idle[:len(x.idle)-1]
+	return conn, true
+}
+
+// put returns conn to the idle connections, or closes it.
+func (x *tlsExchanger) put(conn *dns.Conn) {
+	x.m.Lock()
+	defer x.m.Unlock()
+	if len(x.idle) >= maxIdleConns {
+		conn.Close()
+		return
+	}
+	x.idle = append(x.idle, conn)
+}
+
+// httpsExchanger queries a name server over DNS over HTTPS (RFC 8484).
+// Connections are reused by the underlying http.Transport.
+type httpsExchanger struct {
+	url    *url.URL
+	err    error // invalid URL
+	get    bool
+	client *http.Client
+}
+
+// dnsMessageType is the media type of DNS over HTTPS requests and responses.
+const dnsMessageType = "application/dns-message"
+
+func newHTTPSExchanger(s UpstreamServer) *httpsExchanger {
+	x := &httpsExchanger{get: s.Protocol == ProtocolHTTPSGet}
+	x.url, x.err = url.Parse(s.Addr)
+	if x.err == nil && x.url.Scheme != "https" {
+		x.err = fmt.Errorf("DNS over HTTPS: invalid URL %q", s.Addr)
+	}
+	if x.err != nil {
+		return x
+	}
+	x.client = &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig(s, x.url.Hostname()),
+			MaxIdleConnsPerHost: maxIdleConns,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+	return x
+}
+
+func (x *httpsExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	if x.err != nil {
+		return nil, 0, x.err
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b, err := qmsg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	var req *http.Request
+	if x.get {
+		u := *x.url
+		q := u.Query()
+		q.Set("dns", base64.RawURLEncoding.EncodeToString(b))
+		u.RawQuery = q.Encode()
+		req, err = http.NewRequest(http.MethodGet, u.String(), nil)
+	} else {
+		req, err = http.NewRequest(http.MethodPost, x.url.String(), bytes.NewReader(b))
+		if err == nil {
+			req.Header.Set("Content-Type", dnsMessageType)
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", dnsMessageType)
+
+	res, err := x.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil, time.Since(start), fmt.Errorf("DNS over HTTPS: %s", res.Status)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != dnsMessageType {
+		return nil, time.Since(start), fmt.Errorf("DNS over HTTPS: unexpected content type %q", ct)
+	}
+	b, err = ioutil.ReadAll(io.LimitReader(res.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, time.Since(start), err
+	}
+	rmsg := &dns.Msg{}
+	if err = rmsg.Unpack(b); err != nil {
+		return nil, time.Since(start), err
+	}
+	return rmsg, time.Since(start), nil
+}
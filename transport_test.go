@@ -0,0 +1,172 @@
+package dnsr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+// newTestRecursor returns a testServer answering for example.com.
+func newTestRecursor(t *testing.T) *testServer {
+	s := &testServer{}
+	s.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+www.example.com.    IN A   192.0.2.2
+`)
+	return s
+}
+
+// newTestDoHServer returns a DNS over HTTPS server answering from s,
+// and a counter of requests received with each HTTP method.
+func newTestDoHServer(t *testing.T, s *testServer) (*httptest.Server, map[string]*int32) {
+	methods := map[string]*int32{http.MethodGet: new(int32), http.MethodPost: new(int32)}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var b []byte
+		var err error
+		switch req.Method {
+		case http.MethodGet:
+			b, err = base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns"))
+		case http.MethodPost:
+			if req.Header.Get("Content-Type") != dnsMessageType {
+				http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			b, err = ioutil.ReadAll(req.Body)
+		}
+		qmsg := &dns.Msg{}
+		if err == nil {
+			err = qmsg.Unpack(b)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(methods[req.Method], 1)
+		b, err = s.answer(qmsg).Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(b)
+	}))
+	return srv, methods
+}
+
+// countingListener counts accepted connections.
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return c, err
+}
+
+// newTestDoTServer returns the address of a DNS over TLS server
+// answering from s with cert, a listener counting its connections,
+// and the server, which must be shut down by the caller.
+func newTestDoTServer(t *testing.T, s *testServer, cert tls.Certificate) (string, *countingListener, *dns.Server) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	st.Assert(t, err, nil)
+	cl := &countingListener{Listener: l}
+	srv := &dns.Server{
+		Listener: tls.NewListener(cl, &tls.Config{Certificates: []tls.Certificate{cert}}),
+		Net:      "tcp-tls",
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, qmsg *dns.Msg) {
+			w.WriteMsg(s.answer(qmsg))
+		}),
+	}
+	go srv.ActivateAndServe()
+	return l.Addr().String(), cl, srv
+}
+
+// testTLSConfig returns a TLS configuration trusting the certificate of srv.
+func testTLSConfig(srv *httptest.Server) *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	return &tls.Config{RootCAs: pool}
+}
+
+func TestDoH(t *testing.T) {
+	srv, methods := newTestDoHServer(t, newTestRecursor(t))
+	defer srv.Close()
+	for _, proto := range []Protocol{ProtocolHTTPS, ProtocolHTTPSGet} {
+		r := NewResolver(WithUpstreams(".", UpstreamServer{
+			Addr:      srv.URL + "/dns-query",
+			Protocol:  proto,
+			TLSConfig: testTLSConfig(srv),
+			Pins:      []string{SPKIPin(srv.Certificate())},
+		}))
+		rrs, err := r.ResolveErr("www.example.com", "A")
+		st.Expect(t, err, nil)
+		st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "A", Value: "192.0.2.2", TTL: rrs[0].TTL}})
+		_, err = r.ResolveErr("nope.example.com", "A")
+		st.Expect(t, err, NXDOMAIN)
+	}
+	st.Expect(t, atomic.LoadInt32(methods[http.MethodPost]), int32(2))
+	st.Expect(t, atomic.LoadInt32(methods[http.MethodGet]), int32(2))
+}
+
+func TestDoT(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler()) // for its certificate
+	defer srv.Close()
+	addr, l, dot := newTestDoTServer(t, newTestRecursor(t), srv.TLS.Certificates[0])
+	defer dot.Shutdown()
+	r := NewResolver(WithUpstreams(".", UpstreamServer{
+		Addr:      addr,
+		Protocol:  ProtocolTLS,
+		TLSConfig: testTLSConfig(srv),
+		Pins:      []string{SPKIPin(srv.Certificate())},
+	}))
+	for i := 0; i < 3; i++ {
+		r.cache = newCache(r.capacity, r.expire)
+		rrs, err := r.ResolveErr("www.example.com", "A")
+		st.Expect(t, err, nil)
+		st.Expect(t, len(rrs), 1)
+	}
+	st.Expect(t, atomic.LoadInt32(&l.accepted), int32(1))
+	st.Expect(t, r.Upstreams()[0].Queries, uint64(3))
+}
+
+func TestPinMismatch(t *testing.T) {
+	srv, _ := newTestDoHServer(t, newTestRecursor(t))
+	defer srv.Close()
+	addr, _, dot := newTestDoTServer(t, newTestRecursor(t), srv.TLS.Certificates[0])
+	defer dot.Shutdown()
+	for _, s := range []UpstreamServer{
+		{Addr: srv.URL, Protocol: ProtocolHTTPS},
+		{Addr: addr, Protocol: ProtocolTLS},
+	} {
+		s.TLSConfig = testTLSConfig(srv)
+		s.Pins = []string{base64.StdEncoding.EncodeToString(make([]byte, 32))}
+		r := NewResolver(WithUpstreams(".", s))
+		rrs, _ := r.ResolveErr("www.example.com", "A")
+		st.Expect(t, len(rrs), 0)
+		st.Expect(t, r.Upstreams()[0].Errors, uint64(1))
+	}
+}
+
+func TestBadUpstream(t *testing.T) {
+	for _, s := range []UpstreamServer{
+		{Addr: "http://dns.example/dns-query", Protocol: ProtocolHTTPS},
+		{Addr: "192.0.2.1", Protocol: Protocol(99)},
+	} {
+		r := NewResolver(WithUpstreams(".", s))
+		_, err := r.ResolveErr("www.example.com", "A")
+		st.Expect(t, err != nil, true)
+	}
+}
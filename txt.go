@@ -0,0 +1,105 @@
+package dnsr
+
+import (
+	"strings"
+)
+
+// TXTSegments returns the character-strings of a TXT record, unescaped.
+//
+// The Value of a TXT record holds its character-strings in zone-file
+// format: each quoted, separated by spaces, with quotes, backslashes and
+// unprintable bytes escaped, so the boundaries between character-strings
+// are preserved. For example, the Value of a TXT record with the
+// character-strings hello and world is "hello" "world".
+func (rr *RR) TXTSegments() []string {
+	return splitTXT(rr.Value)
+}
+
+// TXTValue returns the character-strings of a TXT record, unescaped and
+// joined without separators, as for SPF (RFC 7208) and DKIM (RFC 6376)
+// records split into multiple character-strings.
+func (rr *RR) TXTValue() string {
+	return strings.Join(splitTXT(rr.Value), "")
+}
+
+// quoteTXT returns TXT character-strings in zone-file format.
+// Package dns keeps character-strings escaped, so only quotes are added.
+func quoteTXT(txt []string) string {
+	return `"` + strings.Join(txt, `" "`) + `"`
+}
+
+// splitTXT returns the unescaped character-strings of a TXT record
+// value in zone-file format. Unquoted values, as stored by earlier
+// versions of this package, are split on tabs.
+func splitTXT(value string) []string {
+	if !strings.HasPrefix(value, `"`) {
+		return strings.Split(value, "\t")
+	}
+	var txt []string
+	var b []byte
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"':
+			if quoted {
+				txt = append(txt, string(b))
+				b = b[:0]
+			}
+			quoted = !quoted
+		case !quoted:
+			// skip spaces between character-strings
+		case c == '\\' && i+3 < len(value) && isDigits(value[i+1:i+4]):
+			b = append(b, (value[i+1]-'0')*100+(value[i+2]-'0')*10+(value[i+3]-'0'))
+			i += 3
+		case c == '\\' && i+1 < len(value):
+			b = append(b, value[i+1])
+			i++
+		default:
+			b = append(b, c)
+		}
+	}
+	if quoted {
+		txt = append(txt, string(b))
+	}
+	return txt
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFields splits s around spaces and tabs, like strings.Fields,
+// except within quoted strings.
+func splitFields(s string) []string {
+	var fields []string
+	start := -1
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case (c == ' ' || c == '\t' || c == '\n') && !quoted:
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, s[start:])
+	}
+	return fields
+}
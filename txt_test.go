@@ -0,0 +1,67 @@
+package dnsr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestTXTSegments(t *testing.T) {
+	tests := []struct {
+		txt      []string // escaped, as kept by package dns
+		value    string
+		segments []string
+		joined   string
+	}{
+		{[]string{"hello world"}, `"hello world"`, []string{"hello world"}, "hello world"},
+		{[]string{"v=DKIM1; k=rsa; p=MIGf", "MA0GCSqGSIb3"}, `"v=DKIM1; k=rsa; p=MIGf" "MA0GCSqGSIb3"`, []string{"v=DKIM1; k=rsa; p=MIGf", "MA0GCSqGSIb3"}, "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3"},
+		{[]string{"tab\there"}, `"tab\009here"`, []string{"tab\there"}, "tab\there"},
+		{[]string{`quote \" backslash \\`}, `"quote \" backslash \\"`, []string{`quote " backslash \`}, `quote " backslash \`},
+		{[]string{"", "x"}, `"" "x"`, []string{"", "x"}, "x"},
+	}
+	for _, tt := range tests {
+		drr := &dns.TXT{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}, Txt: tt.txt}
+		msg := &dns.Msg{Answer: []dns.RR{drr}}
+		wire, err := msg.Pack()
+		st.Assert(t, err, nil)
+		st.Assert(t, msg.Unpack(wire), nil)
+		rr, ok := convertRR(msg.Answer[0], time.Time{})
+		st.Assert(t, ok, true)
+		st.Expect(t, rr.Value, tt.value)
+		st.Expect(t, rr.TXTSegments(), tt.segments)
+		st.Expect(t, rr.TXTValue(), tt.joined)
+
+		drr2, err := rr.ToDNS()
+		st.Assert(t, err, nil)
+		drr2.Header().Ttl = drr.Hdr.Ttl
+		msg = &dns.Msg{Answer: []dns.RR{drr2}}
+		wire2, err := msg.Pack()
+		st.Assert(t, err, nil)
+		st.Expect(t, wire2, wire)
+	}
+}
+
+func TestTXTLegacy(t *testing.T) {
+	rr := RR{Name: "example.com.", Type: "TXT", Value: "hello\tworld"}
+	st.Expect(t, rr.TXTSegments(), []string{"hello", "world"})
+	st.Expect(t, rr.TXTValue(), "helloworld")
+	drr, err := rr.ToDNS()
+	st.Assert(t, err, nil)
+	st.Expect(t, drr.(*dns.TXT).Txt, []string{"hello", "world"})
+}
+
+func TestSplitFields(t *testing.T) {
+	st.Expect(t, splitFields("a\t 1  IN\tCAA\t0 issue \"a b\\\" c\""), []string{"a", "1", "IN", "CAA", "0", "issue", `"a b\" c"`})
+	st.Expect(t, splitFields(""), []string(nil))
+
+	drr, err := dns.NewRR(`example.com. 300 IN CAA 0 iodef "mailto:a b@example.com"`)
+	st.Assert(t, err, nil)
+	rr, ok := convertRR(drr, time.Time{})
+	st.Assert(t, ok, true)
+	st.Expect(t, rr.Value, "0\tiodef\t\"mailto:a b@example.com\"")
+	rdata, err := rr.RData()
+	st.Expect(t, err, nil)
+	st.Expect(t, rdata, CAA{0, "iodef", "mailto:a b@example.com"})
+}
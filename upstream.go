@@ -0,0 +1,178 @@
+package dnsr
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Upstream health tracking: an upstream name server is marked down after
+// upstreamMaxFailures consecutive failures, for a backoff interval that
+// doubles with each further failure, up to upstreamMaxBackoff.
+const (
+	upstreamMaxFailures = 3
+	upstreamBackoff     = time.Second
+	upstreamMaxBackoff  = time.Minute
+)
+
+// upstream is an upstream recursive name server for a forward zone.
+// Safe for concurrent usage.
+type upstream struct {
+	addr      string
+	transport exchanger // nil for the Resolver's default exchanger
+
+	m         sync.Mutex
+	failures  int       // consecutive failures
+	downUntil time.Time // zero if healthy
+	rtt       time.Duration
+	queries   uint64
+	errors    uint64
+}
+
+// UpstreamStatus describes the health of an upstream recursive name server.
+type UpstreamStatus struct {
+	Zone     string
+	Addr     string
+	Healthy  bool
+	Failures int           // consecutive failures
+	RTT      time.Duration // smoothed round-trip time
+	Queries  uint64
+	Errors   uint64
+}
+
+// WithForwarders enables forwarding mode. Instead of iterating from the
+// root name servers, all names are resolved by sending recursive queries
+// to the upstream name servers at addrs, with failover to the next healthy
+// upstream name server. Each address is an IP address, with an optional
+// port (default 53). Stub and forward zones take precedence.
+func WithForwarders(addrs ...string) Option {
+	return WithForwardZone(".", addrs...)
+}
+
+// WithUpstreams specifies upstream recursive name servers for zone, like
+// WithForwardZone, with a transport for each name server: UDP, DNS over TLS
+// or DNS over HTTPS. Use zone "." for forwarding mode.
+func WithUpstreams(zone string, servers ...UpstreamServer) Option {
+	return func(r *Resolver) {
+		addrs := make([]string, len(servers))
+		us := make([]*upstream, len(servers))
+		for i, s := range servers {
+			addrs[i] = s.Addr
+			us[i] = &upstream{addr: s.Addr, transport: newTransport(s)}
+		}
+		r.addZone(&zoneConfig{zone: toLowerFQDN(zone), forward: true, addrs: addrs, upstreams: us})
+	}
+}
+
+func newUpstreams(addrs []string) []*upstream {
+	us := make([]*upstream, len(addrs))
+	for i, addr := range addrs {
+		us[i] = &upstream{addr: addr}
+	}
+	return us
+}
+
+// query sends qmsg for zone to u using its transport, or the default exchanger of r.
+func (u *upstream) query(ctx context.Context, r *Resolver, zone string, qmsg *dns.Msg, depth int) (*dns.Msg, error) {
+	if u.transport == nil {
+		return r.query(ctx, zone, u.addr, u.addr, qmsg, depth)
+	}
+	return r.queryWith(ctx, u.transport, zone, u.addr, u.addr, qmsg, depth)
+}
+
+// success records a successful query to u.
+func (u *upstream) success(rtt time.Duration) {
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.queries++
+	u.failures = 0
+	u.downUntil = time.Time{}
+	if u.rtt == 0 {
+		u.rtt = rtt
+	} else {
+		u.rtt = (7*u.rtt + rtt) / 8
+	}
+}
+
+// failure records a failed query to u at time now, marking it down if necessary.
+func (u *upstream) failure(now time.Time) {
+	u.m.Lock()
+	defer u.m.Unlock()
+	u.queries++
+	u.errors++
+	u.failures++
+	if u.failures < upstreamMaxFailures {
+		return
+	}
+	backoff := upstreamBackoff << uint(u.failures-upstreamMaxFailures)
+	if backoff > upstreamMaxBackoff || backoff <= 0 {
+		backoff = upstreamMaxBackoff
+	}
+	u.downUntil = now.Add(backoff)
+}
+
+// down returns the time until which u is down, or the zero time.
+func (u *upstream) down(now time.Time) time.Time {
+	u.m.Lock()
+	defer u.m.Unlock()
+	if now.After(u.downUntil) {
+		return time.Time{}
+	}
+	return u.downUntil
+}
+
+// status returns the status of u for zone.
+func (u *upstream) status(zone string, now time.Time) UpstreamStatus {
+	u.m.Lock()
+	defer u.m.Unlock()
+	return UpstreamStatus{
+		Zone:     zone,
+		Addr:     u.addr,
+		Healthy:  !now.Before(u.downUntil),
+		Failures: u.failures,
+		RTT:      u.rtt,
+		Queries:  u.queries,
+		Errors:   u.errors,
+	}
+}
+
+// orderUpstreams returns us in order of preference: healthy upstream name servers
+// in configured order, then name servers that are down at time now, soonest up first.
+func orderUpstreams(us []*upstream, now time.Time) []*upstream {
+	out := make([]*upstream, 0, len(us))
+	var down []*upstream
+	downUntil := make(map[*upstream]time.Time)
+	for _, u := range us {
+		if t := u.down(now); !t.IsZero() {
+			down = append(down, u)
+			downUntil[u] = t
+		} else {
+			out = append(out, u)
+		}
+	}
+	sort.SliceStable(down, func(i, j int) bool { return downUntil[down[i]].Before(downUntil[down[j]]) })
+	return append(out, down...)
+}
+
+// Upstreams returns the status of the upstream name servers
+// for forwarding mode and forward zones, sorted by zone.
+func (r *Resolver) Upstreams() []UpstreamStatus {
+	now := r.clock.Now()
+	var zones []string
+	for name, z := range r.zones {
+		if z.forward {
+			zones = append(zones, name)
+		}
+	}
+	sort.Strings(zones)
+	var out []UpstreamStatus
+	for _, name := range zones {
+		for _, u := range r.zones[name].upstreams {
+			out = append(out, u.status(name, now))
+		}
+	}
+	return out
+}
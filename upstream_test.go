@@ -0,0 +1,118 @@
+package dnsr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestUpstreamHealth(t *testing.T) {
+	a, b := &upstream{addr: "192.0.2.1"}, &upstream{addr: "192.0.2.2"}
+	us := []*upstream{a, b}
+	now := time.Now()
+	st.Expect(t, orderUpstreams(us, now), us)
+	for i := 0; i < upstreamMaxFailures; i++ {
+		a.failure(now)
+	}
+	st.Expect(t, a.down(now).IsZero(), false)
+	st.Expect(t, orderUpstreams(us, now), []*upstream{b, a})
+	st.Expect(t, a.status(".", now), UpstreamStatus{
+		Zone: ".", Addr: "192.0.2.1", Failures: upstreamMaxFailures,
+		Queries: upstreamMaxFailures, Errors: upstreamMaxFailures,
+	})
+	a.success(10 * time.Millisecond)
+	st.Expect(t, a.down(now).IsZero(), true)
+	st.Expect(t, orderUpstreams(us, now), us)
+	st.Expect(t, a.status(".", now).RTT, 10*time.Millisecond)
+	st.Expect(t, a.status(".", now).Healthy, true)
+
+	for i := 0; i < 100; i++ {
+		a.failure(now)
+	}
+	st.Expect(t, a.down(now.Add(upstreamMaxBackoff-time.Second)).IsZero(), false)
+	st.Expect(t, a.down(now.Add(upstreamMaxBackoff+time.Second)).IsZero(), true)
+}
+
+func TestForwarders(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	recursor := n.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+www.example.com.    IN A   192.0.2.2
+mail.example.com.   IN A   192.0.2.3
+ftp.example.com.    IN A   192.0.2.4
+`, "10.3.0.2")
+	recursor.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Authoritative = false
+		rmsg.RecursionAvailable = qmsg.RecursionDesired
+		return rmsg
+	}
+	r := newTestResolver(n, WithForwarders("10.3.0.1", "10.3.0.2"))
+	for _, name := range []string{"www", "mail", "ftp"} {
+		rrs, err := r.ResolveErr(name+".example.com", "A")
+		st.Expect(t, err, nil)
+		st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+	}
+	_, err := r.ResolveErr("nope.example.com", "A")
+	st.Expect(t, err, NXDOMAIN)
+	st.Expect(t, len(root.queries), 0)
+
+	us := r.Upstreams()
+	st.Assert(t, len(us), 2)
+	st.Expect(t, us[0].Addr, "10.3.0.1")
+	st.Expect(t, us[0].Healthy, false)
+	st.Expect(t, us[0].Queries, uint64(upstreamMaxFailures))
+	st.Expect(t, us[1].Addr, "10.3.0.2")
+	st.Expect(t, us[1].Healthy, true)
+	st.Expect(t, us[1].Queries, uint64(4))
+}
+
+// silentExchanger is an exchanger on which the addresses in silent never
+// answer: each query to them times out, advancing clock by the timeout.
+type silentExchanger struct {
+	exchanger
+	clock  *testClock
+	silent map[string]bool
+}
+
+func (x *silentExchanger) exchange(ctx context.Context, qmsg *dns.Msg, addr string, timeout time.Duration) (*dns.Msg, time.Duration, error) {
+	if x.silent[addr] {
+		x.clock.advance(timeout)
+		return nil, timeout, ErrTimeout
+	}
+	return x.exchanger.exchange(ctx, qmsg, addr, timeout)
+}
+
+func TestForwardersSilent(t *testing.T) {
+	n := newTestNet(t)
+	recursor := n.add(t, `
+example.com.        IN SOA ns1.example.com. hostmaster.example.com. 1 1800 900 604800 300
+www.example.com.    IN A   192.0.2.2
+`, "10.3.0.2")
+	recursor.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rmsg.Authoritative = false
+		rmsg.RecursionAvailable = qmsg.RecursionDesired
+		return rmsg
+	}
+	clock := newTestClock()
+	r := newTestResolver(n, WithForwarders("10.3.0.1", "10.3.0.2"), WithTimeout(500*time.Millisecond), WithClock(clock))
+	r.exchanger = &silentExchanger{exchanger: n, clock: clock, silent: map[string]bool{"10.3.0.1:53": true}}
+	start := clock.Now()
+	rrs, err := r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Value == "192.0.2.2" }), 1)
+	elapsed := clock.Now().Sub(start) // 10.3.0.1 had half of the timeout
+	st.Expect(t, elapsed > 200*time.Millisecond && elapsed <= 250*time.Millisecond, true)
+
+	us := r.Upstreams()
+	st.Assert(t, len(us), 2)
+	st.Expect(t, us[0].Addr, "10.3.0.1")
+	st.Expect(t, us[0].Errors, uint64(1))
+	st.Expect(t, us[0].Failures, 1)
+	st.Expect(t, us[1].Addr, "10.3.0.2")
+	st.Expect(t, us[1].Queries, uint64(1))
+	st.Expect(t, us[1].Errors, uint64(0))
+}
@@ -0,0 +1,112 @@
+package dnsr
+
+import (
+	"context"
+	"errors"
+
+	"github.com/miekg/dns"
+)
+
+// zoneConfig configures resolution of names in a zone. A stub zone is
+// iterated starting at its authoritative name servers. A forward zone is
+// queried recursively at upstream name servers.
+type zoneConfig struct {
+	zone      string
+	forward   bool
+	addrs     []string
+	upstreams []*upstream
+}
+
+// WithStubZone specifies the authoritative name servers for zone.
+// Names in zone are resolved iteratively starting at these name servers,
+// instead of the root name servers. Each address is an IP address,
+// with an optional port (default 53).
+func WithStubZone(zone string, addrs ...string) Option {
+	return func(r *Resolver) {
+		r.addZone(&zoneConfig{zone: toLowerFQDN(zone), addrs: addrs})
+	}
+}
+
+// WithForwardZone specifies upstream recursive name servers for zone.
+// Names in zone are resolved by sending recursive queries to these
+// name servers, in order, until one responds. Name servers that fail
+// repeatedly are tried last until they recover. Each address is an
+// IP address, with an optional port (default 53).
+func WithForwardZone(zone string, addrs ...string) Option {
+	return func(r *Resolver) {
+		r.addZone(&zoneConfig{zone: toLowerFQDN(zone), forward: true, addrs: addrs, upstreams: newUpstreams(addrs)})
+	}
+}
+
+func (r *Resolver) addZone(z *zoneConfig) {
+	if r.zones == nil {
+		r.zones = make(map[string]*zoneConfig)
+	}
+	r.zones[z.zone] = z
+}
+
+// zoneFor returns the configuration for the longest zone containing qname, or nil.
+func (r *Resolver) zoneFor(qname string) *zoneConfig {
+	if r.zones == nil {
+		return nil
+	}
+	for name, ok := qname, true; ok; name, ok = parent(name) {
+		if z := r.zones[name]; z != nil {
+			return z
+		}
+	}
+	return nil
+}
+
+// nameservers returns the name servers for a stub zone.
+func (z *zoneConfig) nameservers() []nameserver {
+	nss := make([]nameserver, len(z.addrs))
+	for i, addr := range z.addrs {
+		nss[i] = nameserver{host: addr, addrs: []string{addr}}
+	}
+	return nss
+}
+
+// forward sends a recursive query for qname and qtype to the upstream
+// name servers for forward zone z, in order of health, until one responds.
+// Each upstream name server has an equal share of the time left; one that
+// times out is marked as failed and the next is tried.
+// Upstream name servers are trusted only for z: records outside of z
+// are not cached.
+func (r *Resolver) forward(ctx context.Context, z *zoneConfig, qname, qtype string, depth int) (RRs, error) {
+	qmsg := r.newQuery(qname, qtype)
+	qmsg.MsgHdr.RecursionDesired = true
+
+	err := ErrNoResponse
+	us := orderUpstreams(z.upstreams, r.clock.Now())
+	for i, u := range us {
+		if r.expiring(ctx) {
+			return nil, ErrTimeout
+		}
+		var rmsg *dns.Msg
+		start := r.clock.Now()
+		rmsg, err = u.query(r.withAttempt(ctx, len(us)-i), r, z.zone, qmsg, depth)
+		if budgetExceeded(err) || (err != nil && err == ctx.Err()) {
+			return nil, err
+		}
+		if err != nil {
+			u.failure(r.clock.Now())
+			continue
+		}
+		switch rmsg.Rcode {
+		case dns.RcodeSuccess:
+		case dns.RcodeNameError:
+			u.success(r.clock.Now().Sub(start))
+			r.cache.addNX(qname)
+			return nil, NXDOMAIN
+		default:
+			u.failure(r.clock.Now())
+			err = errors.New(dns.RcodeToString[rmsg.Rcode])
+			continue
+		}
+		u.success(r.clock.Now().Sub(start))
+		rrs := r.saveDNSRR(ctx, u.addr, z.zone, qname, rmsg, depth)
+		return r.resolveCNAMEs(ctx, qname, qtype, rrs, depth)
+	}
+	return nil, err
+}
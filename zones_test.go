@@ -0,0 +1,94 @@
+package dnsr
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/nbio/st"
+)
+
+func TestStubZone(t *testing.T) {
+	n := newTestNet(t)
+	root := n.server("198.41.0.4")
+	corp := n.add(t, `
+corp.               IN SOA ns.corp. hostmaster.corp. 1 1800 900 604800 300
+corp.               IN NS  ns.corp.
+ns.corp.            IN A   10.1.0.1
+www.corp.           IN A   10.1.1.1
+`, "10.1.0.1:5353")
+	r := newTestResolver(n, WithStubZone("CORP", "10.1.0.1:5353"))
+	rrs, err := r.ResolveErr("www.corp", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" && rr.Value == "10.1.1.1" }), 1)
+	rrs, err = r.ResolveErr("corp", "NS")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "NS" }), 1)
+	st.Expect(t, corp.count("www.corp.") > 0, true)
+	st.Expect(t, root.count("corp."), 0)
+
+	// Other names are resolved normally
+	rrs, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "A" }), 1)
+}
+
+func TestForwardZone(t *testing.T) {
+	n := newTestNet(t)
+	var rd []bool
+	upstream := n.add(t, `
+corp.               IN SOA ns.corp. hostmaster.corp. 1 1800 900 604800 300
+www.corp.           IN CNAME web.corp.
+web.corp.           IN A   10.1.1.1
+`, "10.2.0.1")
+	upstream.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rd = append(rd, qmsg.RecursionDesired)
+		rmsg.Authoritative = false
+		rmsg.RecursionAvailable = true
+		if rmsg.Question[0].Name == "www.corp." {
+			rr, _ := dns.NewRR("web.corp. 300 IN A 10.1.1.1")
+			rmsg.Answer = append(rmsg.Answer, rr)
+		}
+		return rmsg
+	}
+	r := newTestResolver(n, WithForwardZone("corp", "10.2.0.99", "10.2.0.1"))
+	rrs, err := r.ResolveErr("www.corp", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, count(rrs, func(rr RR) bool { return rr.Type == "CNAME" && rr.Value == "web.corp." }) > 0, true)
+	st.Expect(t, rd, []bool{true})
+	st.Expect(t, r.cache.get("web.corp."), RRs{{Name: "web.corp.", Type: "A", Value: "10.1.1.1"}})
+
+	_, err = r.ResolveErr("nope.corp", "A")
+	st.Expect(t, err, NXDOMAIN)
+}
+
+func TestForwardZoneBailiwick(t *testing.T) {
+	n := newTestNet(t)
+	upstream := n.add(t, `
+corp.               IN SOA ns.corp. hostmaster.corp. 1 1800 900 604800 300
+www.corp.           IN A   10.1.1.1
+`, "10.2.0.1")
+	upstream.rewrite = func(qmsg, rmsg *dns.Msg) *dns.Msg {
+		rr, _ := dns.NewRR("www.example.com. 300 IN A 203.0.113.66")
+		rmsg.Extra = append(rmsg.Extra, rr)
+		return rmsg
+	}
+	r := newTestResolver(n, WithForwardZone("corp", "10.2.0.1"))
+	rrs, err := r.ResolveErr("www.corp", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.corp.", Type: "A", Value: "10.1.1.1"}})
+	st.Expect(t, r.cache.get("www.example.com."), RRs(nil))
+	st.Expect(t, r.Stats().OutOfBailiwick, uint64(1))
+
+	rrs, err = r.ResolveErr("www.example.com", "A")
+	st.Expect(t, err, nil)
+	st.Expect(t, rrs, RRs{{Name: "www.example.com.", Type: "A", Value: "192.0.2.2"}})
+}
+
+func TestZoneFor(t *testing.T) {
+	r := NewResolver(WithForwardZone("corp", "10.2.0.1"), WithStubZone("lab.corp.", "10.1.0.1"))
+	st.Expect(t, r.zoneFor("www.corp.").forward, true)
+	st.Expect(t, r.zoneFor("www.lab.corp.").forward, false)
+	st.Expect(t, r.zoneFor("lab.corp.").zone, "lab.corp.")
+	st.Expect(t, r.zoneFor("example.com."), (*zoneConfig)(nil))
+	st.Expect(t, NewResolver().zoneFor("example.com."), (*zoneConfig)(nil))
+}